@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/assert"
+)
+
+const (
+	adminAuthHeader = "Bearer gggggggggggggggggggggggggg"
+	userAuthHeader  = "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestListUsers(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		authHeader string
+		wantCode   int
+	}{
+		{
+			name:       "Admin",
+			query:      "?search=example&sort=-name",
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Invalid sort",
+			query:      "?sort=password_hash",
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Not an admin",
+			authHeader: userAuthHeader,
+			wantCode:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerToTest := app.authenticate(app.requirePermission("users:admin", app.listUsersHandler))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/admin/users"+tt.query, nil)
+			req.Header.Set("Authorization", tt.authHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestUpdateUserPermissions(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.updateUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.updateUserPermissionsHandler))
+	handlerToTest := app.authenticate(router)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		codes      []string
+		authHeader string
+		wantCode   int
+	}{
+		{
+			name:       "Grant",
+			method:     http.MethodPost,
+			url:        "/v1/admin/users/1/permissions",
+			codes:      []string{"movies:write"},
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Revoke",
+			method:     http.MethodDelete,
+			url:        "/v1/admin/users/1/permissions",
+			codes:      []string{"movies:write"},
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "No codes",
+			method:     http.MethodPost,
+			url:        "/v1/admin/users/1/permissions",
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown code",
+			method:     http.MethodPost,
+			url:        "/v1/admin/users/1/permissions",
+			codes:      []string{"movies:wrte"},
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Unknown user",
+			method:     http.MethodPost,
+			url:        "/v1/admin/users/99/permissions",
+			codes:      []string{"movies:write"},
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "Not an admin",
+			method:     http.MethodPost,
+			url:        "/v1/admin/users/1/permissions",
+			codes:      []string{"users:admin"},
+			authHeader: userAuthHeader,
+			wantCode:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(map[string][]string{"codes": tt.codes})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewReader(b))
+			req.Header.Set("Authorization", tt.authHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestListUsersWithPermission(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions/:code/users", app.requirePermission("users:admin", app.listUsersWithPermissionHandler))
+	handlerToTest := app.authenticate(router)
+
+	tests := []struct {
+		name    string
+		code    string
+		wantIDs []int64
+	}{
+		{
+			name:    "Exact code",
+			code:    "movies:read",
+			wantIDs: []int64{1, 3, 4},
+		},
+		{
+			name:    "Held directly or through a wildcard",
+			code:    "movies:write",
+			wantIDs: []int64{3, 4},
+		},
+		{
+			name:    "Only through a wildcard",
+			code:    "movies:admin",
+			wantIDs: []int64{4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/admin/permissions/"+tt.code+"/users", nil)
+			req.Header.Set("Authorization", adminAuthHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, http.StatusOK)
+
+			var resp struct {
+				Users []struct {
+					ID int64 `json:"id"`
+				} `json:"users"`
+			}
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, user := range resp.Users {
+				ids = append(ids, user.ID)
+			}
+			assert.Equal(t, fmt.Sprint(ids), fmt.Sprint(tt.wantIDs))
+		})
+	}
+}
+
+func TestUpdateUserActivated(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.updateUserActivatedHandler))
+	handlerToTest := app.authenticate(router)
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Deactivate",
+			url:      "/v1/admin/users/1/activated",
+			body:     `{"activated": false}`,
+			wantCode: http.StatusOK,
+			wantBody: `"disabled":true`,
+		},
+		{
+			name:     "Reactivate",
+			url:      "/v1/admin/users/1/activated",
+			body:     `{"activated": true}`,
+			wantCode: http.StatusOK,
+			wantBody: `"disabled":false`,
+		},
+		{
+			name:     "Missing activated",
+			url:      "/v1/admin/users/1/activated",
+			body:     `{}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Own account",
+			url:      "/v1/admin/users/4/activated",
+			body:     `{"activated": false}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.url, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Authorization", adminAuthHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUpdateUserRoles(t *testing.T) {
+	app := newTestApplication(t)
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.updateUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.updateUserRolesHandler))
+	handlerToTest := app.authenticate(router)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		roles    []string
+		wantCode int
+	}{
+		{
+			name:     "Assign",
+			method:   http.MethodPost,
+			url:      "/v1/admin/users/1/roles",
+			roles:    []string{"editor"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Unknown role",
+			method:   http.MethodPost,
+			url:      "/v1/admin/users/1/roles",
+			roles:    []string{"superuser"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Remove own admin role",
+			method:   http.MethodDelete,
+			url:      "/v1/admin/users/4/roles",
+			roles:    []string{"admin"},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(map[string][]string{"roles": tt.roles})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewReader(b))
+			req.Header.Set("Authorization", adminAuthHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
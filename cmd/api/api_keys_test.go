@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		Name        string
+		Permissions []string
+		authHeader  string
+		wantCode    int
+	}{
+		{
+			name:        "Valid submission",
+			Name:        "importer",
+			Permissions: []string{"movies:read"},
+			authHeader:  "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:    http.StatusCreated,
+		},
+		{
+			name:       "Empty name",
+			Name:       "",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Permission the user doesn't have",
+			Name:        "importer",
+			Permissions: []string{"movies:write"},
+			authHeader:  "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Authenticated with an API key",
+			Name:       "importer",
+			authHeader: "ApiKey gl_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Name        string   `json:"name"`
+				Permissions []string `json:"permissions"`
+			}{
+				Name:        tt.Name,
+				Permissions: tt.Permissions,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			handlerToTest := app.authenticate(app.requireActivatedUser(app.createAPIKeyHandler))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/api-keys", bytes.NewReader(b))
+			req.Header.Set("Authorization", tt.authHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestTTLCache(t *testing.T) {
+	c := newTTLCache[int](50 * time.Millisecond)
+
+	c.Set("a", 1)
+	got, ok := c.Get("a")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, got, 1)
+
+	_, ok = c.Get("b")
+	assert.Equal(t, ok, false)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = c.Get("a")
+	assert.Equal(t, ok, false)
+
+	disabled := newTTLCache[int](0)
+	disabled.Set("a", 1)
+	_, ok = disabled.Get("a")
+	assert.Equal(t, ok, false)
+}
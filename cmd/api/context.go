@@ -8,7 +8,15 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey       = contextKey("user")
+	tokenContextKey      = contextKey("token")
+	apiKeyContextKey     = contextKey("apiKey")
+	membershipContextKey = contextKey("membership")
+	// tokenOrgContextKey holds the organization a signed token was issued for,
+	// which requireOrganization() turns into a membership.
+	tokenOrgContextKey = contextKey("tokenOrg")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +30,59 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetToken(r *http.Request, tokenPlaintext string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, tokenPlaintext)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken() returns the bearer token used to authenticate the request,
+// or an empty string if the request was authenticated some other way.
+func (app *application) contextGetToken(r *http.Request) string {
+	tokenPlaintext, _ := r.Context().Value(tokenContextKey).(string)
+	return tokenPlaintext
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey() returns the API key used to authenticate the request, or
+// nil if there wasn't one.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+func (app *application) contextSetTokenOrg(r *http.Request, orgID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenOrgContextKey, orgID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetTokenOrg(r *http.Request) int64 {
+	orgID, _ := r.Context().Value(tokenOrgContextKey).(int64)
+	return orgID
+}
+
+func (app *application) contextSetMembership(r *http.Request, membership *data.Membership) *http.Request {
+	ctx := context.WithValue(r.Context(), membershipContextKey, membership)
+	return r.WithContext(ctx)
+}
+
+// contextGetMembership() returns the user's membership in the organization
+// selected for the request, or nil if no organization was selected.
+func (app *application) contextGetMembership(r *http.Request) *data.Membership {
+	membership, _ := r.Context().Value(membershipContextKey).(*data.Membership)
+	return membership
+}
+
+// contextGetOrganizationID() returns the ID of the organization selected for
+// the request, or zero if there isn't one. The data layer treats zero as
+// matching nothing.
+func (app *application) contextGetOrganizationID(r *http.Request) int64 {
+	if membership := app.contextGetMembership(r); membership != nil {
+		return membership.OrganizationID
+	}
+	return 0
+}
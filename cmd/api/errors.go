@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -56,6 +59,18 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "this account has been temporarily locked after too many failed login attempts"
+	app.errorResponse(w, r, http.StatusLocked, message)
+}
+
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please wait before trying again"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -67,6 +82,27 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or already used refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) signedTokenSessionsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "signed authentication tokens can't be listed or revoked, they stay valid until they expire"
+	app.errorResponse(w, r, http.StatusNotImplemented, message)
+}
+
+func (app *application) apiKeyLogoutResponse(w http.ResponseWriter, r *http.Request) {
+	message := "API keys can't be logged out, revoke the key instead"
+	app.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "ApiKey")
+	message := "invalid, expired or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -77,7 +113,37 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+func (app *application) accountDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been deactivated by an administrator"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) registrationClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "registration is by invitation only"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) notMemberResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you are not a member of the requested organization"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) organizationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "an organization must be selected with the X-Org header"
+	app.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
-}
\ No newline at end of file
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has changed since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a test operation in the patch failed, the movie doesn't have the expected value"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"greenlight.bcc/internal/data"
+)
+
+// movieETag() returns the strong entity tag for a movie. The version changes
+// whenever the movie's details do, so it identifies the representation.
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d"`, movie.Version)
+}
+
+// etagMatches() reports whether an If-Match or If-None-Match header value
+// lists the entity tag. If-Match uses strong comparison, where weak tags
+// never match; If-None-Match uses weak comparison, which ignores the W/
+// prefix.
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified() sets the ETag header and, if the request's If-None-Match
+// already lists the tag, writes a 304 Not Modified response. The caller
+// should stop if it returns true.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == "" || !etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch() writes a 412 Precondition Failed response if the request has
+// an If-Match header that doesn't list the entity tag, so a client can make
+// a change conditional on the version it last saw. The caller should stop if
+// it returns false.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, etag, false) {
+		return true
+	}
+
+	app.preconditionFailedResponse(w, r)
+	return false
+}
+
+// writeListJSON() writes a 200 OK JSON response with a weak ETag computed
+// from the body, or a 304 Not Modified if the client already has it. The tag
+// is weak because it's only good for revalidating a cached copy of the page.
+func (app *application) writeListJSON(w http.ResponseWriter, r *http.Request, data envelope) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(js)
+	if app.notModified(w, r, fmt.Sprintf(`W/"%x"`, sum[:16])) {
+		return nil
+	}
+
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write(js)
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{`"2"`, `"2"`, false, true},
+		{`"1", "2"`, `"2"`, false, true},
+		{`"1"`, `"2"`, false, false},
+		{`*`, `"2"`, false, true},
+		{`W/"2"`, `"2"`, false, false},
+		{`"2"`, `W/"2"`, false, false},
+		{`W/"2"`, `"2"`, true, true},
+		{`"abc"`, `W/"abc"`, true, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, etagMatches(tt.header, tt.etag, tt.weak), tt.want)
+	}
+}
+
+func TestMovieConditionalRequests(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	send := func(method, urlPath string, body []byte, header, value string) (int, http.Header) {
+		req, err := http.NewRequest(method, ts.URL+urlPath, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		return rs.StatusCode, rs.Header
+	}
+
+	// Mock movie 1 is at version 2.
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     []byte
+		header   string
+		value    string
+		wantCode int
+		wantETag string
+	}{
+		{"Show", http.MethodGet, "/v1/movies/1", nil, "", "", http.StatusOK, `"2"`},
+		{"Show with current ETag", http.MethodGet, "/v1/movies/1", nil, "If-None-Match", `"2"`, http.StatusNotModified, `"2"`},
+		{"Show with stale ETag", http.MethodGet, "/v1/movies/1", nil, "If-None-Match", `"1"`, http.StatusOK, `"2"`},
+		{"Update with current ETag", http.MethodPatch, "/v1/movies/1", []byte(`{"title":"New"}`), "If-Match", `"2"`, http.StatusOK, `"2"`},
+		{"Update with stale ETag", http.MethodPatch, "/v1/movies/1", []byte(`{"title":"New"}`), "If-Match", `"1"`, http.StatusPreconditionFailed, ""},
+		{"Revert with current ETag", http.MethodPost, "/v1/movies/1/revisions/1/revert", nil, "If-Match", `"2"`, http.StatusOK, `"2"`},
+		{"Revert with stale ETag", http.MethodPost, "/v1/movies/1/revisions/1/revert", nil, "If-Match", `"1"`, http.StatusPreconditionFailed, ""},
+		{"Delete with stale ETag", http.MethodDelete, "/v1/movies/1", nil, "If-Match", `"1"`, http.StatusPreconditionFailed, ""},
+		{"Delete with current ETag", http.MethodDelete, "/v1/movies/1", nil, "If-Match", `"2"`, http.StatusOK, ""},
+		{"Delete missing movie with ETag", http.MethodDelete, "/v1/movies/2", nil, "If-Match", `"2"`, http.StatusNotFound, ""},
+		{"Delete changed after the ETag check", http.MethodDelete, "/v1/movies/3", nil, "If-Match", `"1"`, http.StatusPreconditionFailed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header := send(tt.method, tt.urlPath, tt.body, tt.header, tt.value)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantETag != "" {
+				assert.Equal(t, header.Get("ETag"), tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestMovieListETag(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	_, header, _ := ts.get(t, "/v1/movies")
+	etag := header.Get("ETag")
+	assert.StringContains(t, etag, `W/"`)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/movies", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", etag)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	assert.Equal(t, rs.StatusCode, http.StatusNotModified)
+}
@@ -7,10 +7,12 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"greenlight.bcc/internal/validator"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
@@ -127,6 +129,49 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime() reads an RFC 3339 timestamp, or a date in YYYY-MM-DD form taken
+// as midnight UTC. It returns nil if the parameter isn't set.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a date in YYYY-MM-DD format")
+	return nil
+}
+
+// clientIP() returns the host part of the request's remote address, falling
+// back to the raw value if it isn't in host:port form.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
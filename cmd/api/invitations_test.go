@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestCreateInvitation(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		Email       string
+		Permissions []string
+		authHeader  string
+		wantCode    int
+	}{
+		{
+			name:        "Valid submission",
+			Email:       "invited@gmail.com",
+			Permissions: []string{"movies:read", "movies:write"},
+			authHeader:  adminAuthHeader,
+			wantCode:    http.StatusCreated,
+		},
+		{
+			name:       "Existing user",
+			Email:      "example@gmail.com",
+			authHeader: adminAuthHeader,
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Duplicate permissions",
+			Email:       "invited@gmail.com",
+			Permissions: []string{"movies:read", "movies:read"},
+			authHeader:  adminAuthHeader,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "Unknown permission code",
+			Email:       "invited@gmail.com",
+			Permissions: []string{"movies:read", "movies:delete"},
+			authHeader:  adminAuthHeader,
+			wantCode:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "Not an admin",
+			Email:      "invited@gmail.com",
+			authHeader: userAuthHeader,
+			wantCode:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Email       string   `json:"email"`
+				Permissions []string `json:"permissions"`
+			}{
+				Email:       tt.Email,
+				Permissions: tt.Permissions,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			handlerToTest := app.authenticate(app.requirePermission("users:admin", app.createInvitationHandler))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/invitations", bytes.NewReader(b))
+			req.Header.Set("Authorization", tt.authHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.registration.mode = registrationModeInvite
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		Topic    string
+		Token    string
+		Name     string
+		Password string
+		wantCode int
+	}{
+		{
+			Topic:    "Valid invitation",
+			Token:    "iiiiiiiiiiiiiiiiiiiiiiiiii",
+			Name:     "Invited User",
+			Password: "QWERTY549",
+			wantCode: http.StatusCreated,
+		},
+		{
+			Topic:    "Unknown invitation",
+			Token:    "aaaaaaaaaaaaaaaaaaaaaaaaaa",
+			Name:     "Invited User",
+			Password: "QWERTY549",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			Topic:    "Name is not provided",
+			Token:    "iiiiiiiiiiiiiiiiiiiiiiiiii",
+			Password: "QWERTY549",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			Topic:    "Email already registered",
+			Token:    "jjjjjjjjjjjjjjjjjjjjjjjjjj",
+			Name:     "Invited User",
+			Password: "QWERTY549",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Topic, func(t *testing.T) {
+			b, err := json.Marshal(map[string]string{"token": tt.Token, "name": tt.Name, "password": tt.Password})
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForm(t, "/v1/users/invitation", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestRegisterUserInviteOnly(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.registration.mode = registrationModeInvite
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	b, err := json.Marshal(map[string]string{"name": "Amanzhol Bakhtiyar", "email": "new@gmail.com", "password": "QWERTY549"})
+	if err != nil {
+		t.Fatal("wrong input data")
+	}
+
+	code, _, body := ts.postForm(t, "/v1/users", b)
+	t.Log(body)
+	assert.Equal(t, code, http.StatusForbidden)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"os"
@@ -15,10 +16,21 @@ import (
 	"greenlight.bcc/internal/data"
 	"greenlight.bcc/internal/jsonlog"
 	"greenlight.bcc/internal/mailer" // New import
+	"greenlight.bcc/internal/signedtoken"
 )
 
 const version = "1.0.0"
 
+const (
+	tokenModeDatabase = "database"
+	tokenModeSigned   = "signed"
+)
+
+const (
+	registrationModeOpen   = "open"
+	registrationModeInvite = "invite"
+)
+
 type config struct {
 	port int
 	env  string
@@ -43,6 +55,28 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	auth struct {
+		accessTokenTTL  time.Duration
+		refreshTokenTTL time.Duration
+		tokenMode       string
+		signingKeys     map[string][]byte
+		activeKeyID     string
+	}
+	login struct {
+		maxAttempts      int
+		maxAttemptsPerIP int
+		lockoutWindow    time.Duration
+	}
+	registration struct {
+		mode string
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
 }
 
 type application struct {
@@ -50,7 +84,11 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	signer *signedtoken.Signer
 	wg     sync.WaitGroup
+
+	// statsCache holds recent GET /v1/movies/stats results.
+	statsCache *ttlCache[*data.MovieStats]
 }
 
 func main() {
@@ -80,6 +118,39 @@ func main() {
 		return nil
 	})
 
+	// Access tokens keep their original 24 hour lifetime by default, so bearer
+	// clients that never call /v1/tokens/refresh aren't logged out early.
+	// Deployments whose clients all refresh can opt in to a shorter one.
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "auth-access-token-ttl", 24*time.Hour, "Lifetime of authentication (access) tokens, e.g. 15m when clients use refresh tokens")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "auth-refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.StringVar(&cfg.auth.tokenMode, "auth-token-mode", tokenModeDatabase, "Authentication token mode (database|signed); signed tokens can't be revoked before they expire")
+
+	flag.IntVar(&cfg.login.maxAttempts, "login-max-attempts", 10, "Failed logins before an account is locked")
+	flag.IntVar(&cfg.login.maxAttemptsPerIP, "login-max-attempts-per-ip", 100, "Failed logins from one IP address before it is blocked")
+	flag.DurationVar(&cfg.login.lockoutWindow, "login-lockout-window", 15*time.Minute, "Period failed logins are counted over, and lockout duration")
+
+	flag.StringVar(&cfg.registration.mode, "registration-mode", registrationModeOpen, "Who can register (open|invite)")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash before being purged (0 keeps them forever)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is checked for movies to purge")
+
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", 30*time.Second, "How long movie catalog statistics are cached (0 disables caching)")
+
+	flag.Func("auth-signing-keys", "Signing keys for signed tokens as space separated id:secret pairs, the first signs new tokens", func(val string) error {
+		cfg.auth.signingKeys = make(map[string][]byte)
+		for i, pair := range strings.Fields(val) {
+			id, secret, ok := strings.Cut(pair, ":")
+			if !ok || id == "" {
+				return errors.New("signing keys must be in id:secret form")
+			}
+			if i == 0 {
+				cfg.auth.activeKeyID = id
+			}
+			cfg.auth.signingKeys[id] = []byte(secret)
+		}
+		return nil
+	})
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -108,10 +179,30 @@ func main() {
 	}))
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:     cfg,
+		logger:     logger,
+		models:     data.NewModels(db),
+		mailer:     mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		statsCache: newTTLCache[*data.MovieStats](cfg.stats.cacheTTL),
+	}
+
+	if cfg.auth.tokenMode != tokenModeDatabase && cfg.auth.tokenMode != tokenModeSigned {
+		logger.PrintFatal(errors.New("invalid -auth-token-mode value"), nil)
+	}
+
+	if cfg.registration.mode != registrationModeOpen && cfg.registration.mode != registrationModeInvite {
+		logger.PrintFatal(errors.New("invalid -registration-mode value"), nil)
+	}
+
+	if cfg.trash.retention > 0 && cfg.trash.purgeInterval <= 0 {
+		logger.PrintFatal(errors.New("-trash-purge-interval must be positive"), nil)
+	}
+
+	if cfg.auth.tokenMode == tokenModeSigned {
+		app.signer, err = signedtoken.New(cfg.auth.signingKeys, cfg.auth.activeKeyID)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
 	}
 
 	err = app.serve()
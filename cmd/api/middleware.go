@@ -86,9 +86,15 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
 
 		authorizationHeader := r.Header.Get("Authorization")
 
+		if key := r.Header.Get("X-API-Key"); key != "" && authorizationHeader == "" {
+			app.authenticateAPIKey(w, r, next, key)
+			return
+		}
+
 		if authorizationHeader == "" {
 			r = app.contextSetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
@@ -96,6 +102,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, headerParts[1])
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
@@ -103,6 +114,23 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		if app.config.auth.tokenMode == tokenModeSigned {
+			claims, err := app.signer.Verify(token, data.ScopeAuthentication)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// Signed tokens are validated without touching the database, so
+			// the user in the request context only carries what the token does.
+			r = app.contextSetUser(r, &data.User{ID: claims.UserID, Activated: claims.Activated})
+			r = app.contextSetToken(r, token)
+			r = app.contextSetTokenOrg(r, claims.OrganizationID)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
@@ -120,12 +148,43 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		err = app.models.Tokens.Touch(data.ScopeAuthentication, token)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, key); !v.Valid() {
+		app.invalidAPIKeyResponse(w, r)
+		return
+	}
+
+	user, apiKey, err := app.models.APIKeys.GetForKey(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAPIKeyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetAPIKey(r, apiKey)
+
+	next.ServeHTTP(w, r)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -152,17 +211,134 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	return app.requireAuthenticatedUser(fn)
 }
 
-func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+// requireOrganization() selects the organization a request acts on: the one in
+// the X-Org header, else the one a signed token was issued for, else the user's
+// only organization if they belong to exactly one. The user must be a member.
+// Only routes that act on an organization's catalog look it up, so the X-Org
+// header has no effect anywhere else.
+func (app *application) requireOrganization(next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-Org")
+
 		user := app.contextGetUser(r)
+		orgID := app.contextGetTokenOrg(r)
+
+		if header := r.Header.Get("X-Org"); header != "" {
+			id, err := strconv.ParseInt(header, 10, 64)
+			if err != nil || id < 1 {
+				app.badRequestResponse(w, r, errors.New("invalid X-Org header"))
+				return
+			}
+			orgID = id
+		}
+
+		if orgID == 0 {
+			orgs, err := app.models.Organizations.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if len(orgs) != 1 {
+				app.organizationRequiredResponse(w, r)
+				return
+			}
+			orgID = orgs[0].ID
+		}
+
+		membership, err := app.models.Organizations.GetMembership(orgID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notMemberResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetMembership(r, membership)
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// hasPermission() reports whether the request's user holds the permission code,
+// taking into account any limits on the API key used to authenticate. The codes
+// granted to the user directly or through roles apply everywhere; within an
+// organization, the codes of the user's role there are added to them.
+func (app *application) hasPermission(r *http.Request, code string) (bool, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		return false, err
+	}
+
+	if membership := app.contextGetMembership(r); membership != nil {
+		permissions = append(permissions, membership.Permissions...)
+	}
+
+	if !permissions.Include(code) {
+		return false, nil
+	}
+
+	if key := app.contextGetAPIKey(r); key != nil && len(key.Permissions) > 0 && !key.Permissions.Include(code) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		permitted, err := app.hasPermission(r, code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permitted {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireActivatedUser(fn)
+}
+
+// An ownerFunc returns the ID of the user who owns the resource addressed by
+// the request, or zero if it has no owner.
+type ownerFunc func(r *http.Request) (int64, error)
+
+// requireOwnership() only lets a request through if the user owns the resource
+// or holds the override permission code. Resources without an owner can only
+// be changed through the override.
+func (app *application) requireOwnership(overrideCode string, owner ownerFunc, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ownerID, err := owner(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if ownerID != 0 && ownerID == app.contextGetUser(r).ID {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permitted, err := app.hasPermission(r, overrideCode)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 
-		if !permissions.Include(code) {
+		if !permitted {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -182,11 +358,12 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-API-Key, X-Org")
 
 						w.WriteHeader(http.StatusOK)
 						return
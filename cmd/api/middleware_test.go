@@ -3,10 +3,13 @@ package main
 import (
 	"encoding/json"
 	"expvar"
+	"greenlight.bcc/internal/assert"
 	"greenlight.bcc/internal/data"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 const succeed = "\u2713"
@@ -145,6 +148,18 @@ func TestAuthenticate(t *testing.T) {
 			"",
 			http.StatusOK,
 		},
+		{
+			"API key access",
+			"ApiKey gl_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			"example@gmail.com",
+			http.StatusOK,
+		},
+		{
+			"Unknown API key",
+			"ApiKey gl_aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			"",
+			http.StatusUnauthorized,
+		},
 	}
 
 	for _, e := range tests {
@@ -268,7 +283,7 @@ func TestEnableCORS(t *testing.T) {
 			"localhost:8080",
 			"Origin",
 			"OPTIONS, PUT, PATCH, DELETE",
-			"Authorization, Content-Type",
+			"Authorization, Content-Type, If-Match, If-None-Match, X-API-Key, X-Org",
 			http.StatusOK,
 		},
 	}
@@ -381,4 +396,201 @@ func TestMetrics(t *testing.T) {
 			t.Logf("TEST %s\t%s: expected status %v", succeed, e.name, e.wantCode)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestRequirePermissionInOrganization(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// User 1 only holds movies:read globally, user 3 holds movies:write too.
+	tests := []struct {
+		name       string
+		userID     int64
+		membership *data.Membership
+		permission string
+		wantCode   int
+	}{
+		{
+			name:       "Viewer in the organization",
+			userID:     1,
+			membership: &data.Membership{OrganizationID: 1, UserID: 1, Role: "viewer", Permissions: data.Permissions{"movies:read"}},
+			permission: "movies:write",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Editor in the organization",
+			userID:     1,
+			membership: &data.Membership{OrganizationID: 1, UserID: 1, Role: "editor", Permissions: data.Permissions{"movies:read", "movies:write"}},
+			permission: "movies:write",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Global grant inside an organization",
+			userID:     3,
+			membership: &data.Membership{OrganizationID: 1, UserID: 3, Role: "viewer", Permissions: data.Permissions{"movies:read"}},
+			permission: "movies:write",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Outside an organization",
+			userID:     3,
+			permission: "movies:write",
+			wantCode:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerToTest := app.requirePermission(tt.permission, next)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			req = app.contextSetUser(req, &data.User{ID: tt.userID, Name: "Amanzhol Bakhityar", Activated: true})
+			if tt.membership != nil {
+				req = app.contextSetMembership(req, tt.membership)
+			}
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestRequireOwnership(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireOwnership("movies:admin", app.movieOwner, next))
+	handlerToTest := app.authenticate(router)
+
+	tests := []struct {
+		name       string
+		urlPath    string
+		authHeader string
+		wantCode   int
+	}{
+		{
+			name:       "Owner",
+			urlPath:    "/v1/movies/1",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Not the owner",
+			urlPath:    "/v1/movies/3",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Not the owner but has movies:admin",
+			urlPath:    "/v1/movies/3",
+			authHeader: "Bearer gggggggggggggggggggggggggg",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Non-existent movie",
+			urlPath:    "/v1/movies/99",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/v1/movies/1",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, tt.urlPath, nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestRequireOrganization(t *testing.T) {
+	app := newTestApplication(t)
+
+	var gotOrgID int64
+	next := func(w http.ResponseWriter, r *http.Request) {
+		gotOrgID = app.contextGetOrganizationID(r)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	handlerToTest := app.authenticate(app.requireOrganization(next))
+
+	tests := []struct {
+		name       string
+		authHeader string
+		orgHeader  string
+		wantCode   int
+		wantOrgID  int64
+	}{
+		{
+			name:       "Selected with header",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			orgHeader:  "1",
+			wantCode:   http.StatusOK,
+			wantOrgID:  1,
+		},
+		{
+			name:       "Only organization",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusOK,
+			wantOrgID:  1,
+		},
+		{
+			name:       "Not a member",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			orgHeader:  "2",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Invalid header",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			orgHeader:  "acme",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:      "Anonymous",
+			orgHeader: "1",
+			wantCode:  http.StatusUnauthorized,
+			wantOrgID: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOrgID = 0
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			if tt.orgHeader != "" {
+				req.Header.Set("X-Org", tt.orgHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			assert.Equal(t, gotOrgID, tt.wantOrgID)
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/jsonpatch"
 	"greenlight.bcc/internal/validator"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,10 +29,12 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	movie := data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:          input.Title,
+		Year:           input.Year,
+		Runtime:        input.Runtime,
+		Genres:         input.Genres,
+		CreatedBy:      app.contextGetUser(r).ID,
+		OrganizationID: app.contextGetOrganizationID(r),
 	}
 
 	v := validator.New()
@@ -44,6 +52,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(&movie))
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
@@ -52,6 +61,21 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 
 }
 
+// movieOwner() is the ownerFunc used to guard changes to a movie.
+func (app *application) movieOwner(r *http.Request) (int64, error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return 0, data.ErrRecordNotFound
+	}
+
+	movie, err := app.models.Movies.Get(app.contextGetOrganizationID(r), id)
+	if err != nil {
+		return 0, err
+	}
+
+	return movie.CreatedBy, nil
+}
+
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -59,7 +83,7 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(app.contextGetOrganizationID(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -70,6 +94,10 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if app.notModified(w, r, movieETag(movie)) {
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -83,7 +111,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(app.contextGetOrganizationID(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -93,29 +121,45 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
 
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	if !app.checkIfMatch(w, r, movieETag(movie)) {
 		return
 	}
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
-	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	// The Content-Type picks how the body describes the change. Anything
+	// other than the two patch formats is read as a partial movie object.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case mediaTypeJSONPatch, mediaTypeMergePatch:
+		if !app.patchMovie(w, r, movie, mediaType) {
+			return
+		}
+	default:
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
 	}
 
 	v := validator.New()
@@ -124,7 +168,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -136,12 +180,94 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+const (
+	mediaTypeJSONPatch  = "application/json-patch+json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// patchMovie() applies a JSON Patch or JSON Merge Patch request body to the
+// movie's JSON representation, the same document GET /v1/movies/:id returns,
+// and copies the patched details back onto the movie. It writes an error
+// response and returns false if the patch can't be applied; the caller still
+// has to validate the result.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, movie *data.Movie, mediaType string) bool {
+	var patch json.RawMessage
+
+	err := app.readJSON(w, r, &patch)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	doc, err := json.Marshal(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	var patched []byte
+	if mediaType == mediaTypeJSONPatch {
+		patched, err = jsonpatch.Apply(doc, patch)
+	} else {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrInvalidPatch):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	var result struct {
+		ID        int64        `json:"id"`
+		Title     string       `json:"title"`
+		Year      int32        `json:"year"`
+		Runtime   data.Runtime `json:"runtime"`
+		Genres    []string     `json:"genres"`
+		Version   int32        `json:"version"`
+		CreatedBy int64        `json:"created_by"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&result)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("the patched movie is not valid: %w", err))
+		return false
+	}
+
+	v := validator.New()
+	v.Check(result.ID == movie.ID, "id", "cannot be changed")
+	v.Check(result.Version == movie.Version, "version", "cannot be changed")
+	v.Check(result.CreatedBy == movie.CreatedBy, "created_by", "cannot be changed")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	movie.Title = result.Title
+	movie.Year = result.Year
+	movie.Runtime = result.Runtime
+	movie.Genres = result.Genres
+
+	return true
+}
+
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -149,18 +275,42 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// The movie is only fetched when the delete is conditional. Its version is
+	// then passed on to Delete(), so a change made after the If-Match check
+	// still fails the precondition.
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		movie, err := app.models.Movies.Get(app.contextGetOrganizationID(r), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkIfMatch(w, r, movieETag(movie)) {
+			return
+		}
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(app.contextGetOrganizationID(r), id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -168,40 +318,137 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilters
 		data.Filters
+		Facets []string
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Facets = app.readCSV(qs, "facets", []string{})
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.IncludeTotal = app.readBool(qs, "include_total", true, v)
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", "relevance"}
 
+	if input.Filters.Sort == "relevance" {
+		v.Check(input.Title != "", "sort", "relevance can only be used with a title search")
+	}
+
+	data.ValidateMovieFilters(v, input.MovieFilters)
+	data.ValidateFacets(v, input.Facets)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(app.contextGetOrganizationID(r), input.MovieFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": movies, "metadata": metadata}
+
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.GetFacets(app.contextGetOrganizationID(r), input.MovieFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	err = app.writeListJSON(w, r, env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+// readMovieFilters() reads the query string parameters that narrow a movie
+// listing, which are shared by the listing and the catalog statistics.
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	return data.MovieFilters{
+		Title:         app.readString(qs, "title", ""),
+		Genres:        app.readCSV(qs, "genres", []string{}),
+		GenresAny:     app.readCSV(qs, "genres_any", []string{}),
+		GenresExclude: app.readCSV(qs, "genres_exclude", []string{}),
+		YearMin:       int32(app.readInt(qs, "year_min", 0, v)),
+		YearMax:       int32(app.readInt(qs, "year_max", 0, v)),
+		RuntimeMin:    int32(app.readInt(qs, "runtime_min", 0, v)),
+		RuntimeMax:    int32(app.readInt(qs, "runtime_max", 0, v)),
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+	}
+}
+
+// movieStatsHandler() returns aggregate statistics over the movies matching
+// the same filters as listMoviesHandler(). Results are cached for a short
+// time per organization and filter, since dashboards tend to poll them.
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	mf := app.readMovieFilters(qs, v)
+	if data.ValidateMovieFilters(v, mf); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	orgID := app.contextGetOrganizationID(r)
+	key := fmt.Sprintf("%d|%s", orgID, mf.CacheKey())
+
+	stats, ok := app.statsCache.Get(key)
+	if !ok {
+		var err error
+		stats, err = app.models.Movies.GetStats(orgID, mf)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.statsCache.Set(key, stats)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// suggestMoviesHandler() returns title suggestions for a partly typed search,
+// for autocompletion as the user types.
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	titles, err := app.models.Movies.Suggest(app.contextGetOrganizationID(r), q, limit)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
-}
\ No newline at end of file
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
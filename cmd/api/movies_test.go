@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"testing"
 
 	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/data"
 )
 
 func TestShowMovie(t *testing.T) {
@@ -218,6 +221,89 @@ func TestListMovies(t *testing.T) {
 			urlPath:  "/v1/movies?sort=+runtinme",
 			wantCode: http.StatusUnprocessableEntity,
 		},
+		{
+			name:     "Ranges and genre filters",
+			urlPath:  "/v1/movies?year_min=1990&year_max=2000&runtime_min=90&runtime_max=150&genres_any=drama,comedy&genres_exclude=horror&created_after=2023-01-01",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Year range reversed",
+			urlPath:  "/v1/movies?year_min=2000&year_max=1990",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must not be less than year_min",
+		},
+		{
+			name:     "Year before the first film",
+			urlPath:  "/v1/movies?year_min=1700",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Negative runtime",
+			urlPath:  "/v1/movies?runtime_max=-5",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Genre both required and excluded",
+			urlPath:  "/v1/movies?genres_any=drama&genres_exclude=drama",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Invalid created_after",
+			urlPath:  "/v1/movies?created_after=yesterday",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be an RFC 3339 timestamp",
+		},
+		{
+			name:     "Sort by relevance",
+			urlPath:  "/v1/movies?title=godfathr&sort=relevance",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Sort by relevance without a title",
+			urlPath:  "/v1/movies?sort=relevance",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "relevance can only be used with a title search",
+		},
+		{
+			name:     "Facets",
+			urlPath:  "/v1/movies?genres=drama&facets=genres,year",
+			wantCode: http.StatusOK,
+			wantBody: `"facets":{"genres":[{"value":"drama","count":2},{"value":"comedy","count":1}],"year":[{"value":"2020s","count":2}]}`,
+		},
+		{
+			name:     "Unknown facet",
+			urlPath:  "/v1/movies?facets=director",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "is not a known facet",
+		},
+		{
+			name:     "Without total",
+			urlPath:  "/v1/movies?include_total=false",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid include_total value",
+			urlPath:  "/v1/movies?include_total=maybe",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Malformed cursor",
+			urlPath:  "/v1/movies?cursor=abc",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "must be a next_cursor value from a previous response",
+		},
+		{
+			// {"s":"id","v":"20","id":20}
+			name:     "Cursor for a different sort",
+			urlPath:  "/v1/movies?sort=title&cursor=eyJzIjoiaWQiLCJ2IjoiMjAiLCJpZCI6MjB9",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "was issued for a different sort order",
+		},
+		{
+			name:     "Valid cursor",
+			urlPath:  "/v1/movies?cursor=eyJzIjoiaWQiLCJ2IjoiMjAiLCJpZCI6MjB9",
+			wantCode: http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -340,4 +426,169 @@ func TestUpdateMovie(t *testing.T) {
 			assert.Equal(t, code, tt.wantCode)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPatchMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const (
+		jsonPatch  = "application/json-patch+json"
+		mergePatch = "application/merge-patch+json"
+	)
+
+	// Mock movie 1 is "Test Mock" (2023), 105 mins, with a single genre.
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		wantCode    int
+		wantBody    string
+	}{
+		{"Replace genres", jsonPatch, `[{"op":"replace","path":"/genres","value":["drama"]}]`, http.StatusOK, `"genres":["drama"]`},
+		{"Test then replace", jsonPatch, `[{"op":"test","path":"/title","value":"Test Mock"},{"op":"replace","path":"/title","value":"New"}]`, http.StatusOK, `"title":"New"`},
+		{"Failing test", jsonPatch, `[{"op":"test","path":"/title","value":"Other"},{"op":"replace","path":"/title","value":"New"}]`, http.StatusConflict, "test operation"},
+		{"Remove title", jsonPatch, `[{"op":"remove","path":"/title"}]`, http.StatusUnprocessableEntity, "must be provided"},
+		{"Change ID", jsonPatch, `[{"op":"replace","path":"/id","value":7}]`, http.StatusUnprocessableEntity, "cannot be changed"},
+		{"Unknown field", jsonPatch, `[{"op":"add","path":"/director","value":"Curtiz"}]`, http.StatusBadRequest, "director"},
+		{"Bad runtime", jsonPatch, `[{"op":"replace","path":"/runtime","value":120}]`, http.StatusBadRequest, "runtime"},
+		{"Missing path", jsonPatch, `[{"op":"replace","path":"/rating","value":5}]`, http.StatusBadRequest, "invalid patch"},
+		{"Not an operation list", jsonPatch, `{"title":"New"}`, http.StatusBadRequest, "invalid patch"},
+		{"Merge patch", mergePatch, `{"year":2020,"runtime":"95 mins"}`, http.StatusOK, `"year":2020`},
+		{"Merge patch removing genres", mergePatch, `{"genres":null}`, http.StatusUnprocessableEntity, "must be provided"},
+		{"Merge patch changing version", mergePatch, `{"version":9}`, http.StatusUnprocessableEntity, "cannot be changed"},
+		{"Content type with parameters", mergePatch + "; charset=utf-8", `{"title":"New"}`, http.StatusOK, `"title":"New"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+"/v1/movies/1", bytes.NewReader([]byte(tt.patch)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+			body, err := io.ReadAll(rs.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, rs.StatusCode, tt.wantCode)
+			assert.StringContains(t, string(body), tt.wantBody)
+		})
+	}
+}
+
+func TestSuggestMovies(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Prefix",
+			urlPath:  "/v1/movies/suggest?q=tes",
+			wantCode: http.StatusOK,
+			wantBody: `"suggestions":["Test Mock"]`,
+		},
+		{
+			name:     "No matches",
+			urlPath:  "/v1/movies/suggest?q=godf",
+			wantCode: http.StatusOK,
+			wantBody: `"suggestions":[]`,
+		},
+		{
+			name:     "Movies in the trash",
+			urlPath:  "/v1/movies/suggest?q=dele",
+			wantCode: http.StatusOK,
+			wantBody: `"suggestions":[]`,
+		},
+		{
+			name:     "Missing query",
+			urlPath:  "/v1/movies/suggest",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Limit too large",
+			urlPath:  "/v1/movies/suggest?q=tes&limit=500",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Movie IDs still resolve",
+			urlPath:  "/v1/movies/1",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMovieStats(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Whole catalog",
+			urlPath:  "/v1/movies/stats",
+			wantCode: http.StatusOK,
+			wantBody: `"average_runtime":112.5`,
+		},
+		{
+			name:     "Filtered",
+			urlPath:  "/v1/movies/stats?genres=drama&year_min=2000",
+			wantCode: http.StatusOK,
+			wantBody: `"years":[{"year":2021,"count":1},{"year":2023,"count":1}]`,
+		},
+		{
+			name:     "Invalid filter",
+			urlPath:  "/v1/movies/stats?runtime_min=x",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	// The cache is keyed on the parsed filters rather than the raw query
+	// string, so the same filters in another order share the entry.
+	mf := data.MovieFilters{Genres: []string{"drama"}, YearMin: 2000}
+	_, ok := app.statsCache.Get("0|" + mf.CacheKey())
+	assert.Equal(t, ok, true)
+}
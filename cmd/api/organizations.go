@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/validator"
+)
+
+func (app *application) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	orgs, err := app.models.Organizations.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"organizations": orgs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	org := &data.Organization{Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.Insert(org, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"organization": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requireOrganizationAdmin() checks that the user is an admin of the
+// organization named in the URL, writing an error response if they aren't.
+// Members who aren't admins get a 404 so they can't probe other memberships.
+func (app *application) requireOrganizationAdmin(w http.ResponseWriter, r *http.Request, orgID int64) bool {
+	membership, err := app.models.Organizations.GetMembership(orgID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	if membership.Role != "admin" {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// setOrganizationMemberHandler() changes the role of a member of the
+// organization, or invites the user with the email address to join it. Nobody
+// is added without accepting an invitation, and an address without an account
+// gets the same response as an invitation, so the endpoint can't be used to
+// find out who is registered.
+func (app *application) setOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.requireOrganizationAdmin(w, r, orgID) {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Role != "", "role", "must be provided")
+	v.Check(input.Role == "" || validator.PermittedValue(input.Role, names...), "role", fmt.Sprintf("%q is not a known role", input.Role))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.organizationInvitationSentResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.ID == app.contextGetUser(r).ID && input.Role != "admin" {
+		v.AddError("role", "you cannot remove your own admin role")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.UpdateMember(orgID, user.ID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.inviteToOrganization(w, r, orgID, user, input.Role)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership, err := app.models.Organizations.GetMembership(orgID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"membership": membership}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// inviteToOrganization() emails the user an invitation to join the
+// organization with the given role.
+func (app *application) inviteToOrganization(w http.ResponseWriter, r *http.Request, orgID int64, user *data.User, role string) {
+	invitation, err := app.models.Organizations.NewInvitation(orgID, user.Email, role, 7*24*time.Hour)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"organizationName": invitation.OrganizationName,
+			"role":             invitation.Role,
+			"invitationToken":  invitation.Plaintext,
+			"expiry":           invitation.Expiry.Format(time.RFC1123),
+		}
+
+		err = app.mailer.Send(user.Email, "organization_invitation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	app.organizationInvitationSentResponse(w, r)
+}
+
+func (app *application) organizationInvitationSentResponse(w http.ResponseWriter, r *http.Request) {
+	message := "if the email address belongs to an account, an invitation to join the organization has been sent to it"
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptOrganizationInvitationHandler() adds the user to the organization
+// named in an invitation sent to their email address.
+func (app *application) acceptOrganizationInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The user in the request context may only be a snapshot from a signed
+	// token, without the email address the invitation is checked against.
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	orgID, err := app.models.Organizations.AcceptInvitation(input.TokenPlaintext, user.Email, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrAlreadyMember):
+			v.AddError("token", "you are already a member of the organization")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership, err := app.models.Organizations.GetMembership(orgID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"membership": membership}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("user_id"), 10, 64)
+	if err != nil || userID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireOrganizationAdmin(w, r, orgID) {
+		return
+	}
+
+	if userID == app.contextGetUser(r).ID {
+		v := validator.New()
+		v.AddError("user_id", "you cannot remove yourself from the organization")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Organizations.RemoveMember(orgID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
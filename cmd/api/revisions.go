@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/validator"
+)
+
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	version, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
+// getMovieRevision() fetches a revision of the movie, writing a not found
+// response if either doesn't exist.
+func (app *application) getMovieRevision(w http.ResponseWriter, r *http.Request, movieID int64, version int32) (*data.MovieRevision, bool) {
+	rev, err := app.models.MovieRevisions.Get(app.contextGetOrganizationID(r), movieID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return rev, true
+}
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	orgID := app.contextGetOrganizationID(r)
+
+	_, err = app.models.Movies.Get(orgID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, err := app.models.MovieRevisions.GetAllForMovie(orgID, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeListJSON(w, r, envelope{"revisions": revisions})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffMovieRevisionsHandler() lists the fields that changed between the
+// versions given by the from and to query string parameters.
+func (app *application) diffMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.readInt(qs, "from", 0, v)
+	to := app.readInt(qs, "to", 0, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	v.Check(from > 0 && from <= math.MaxInt32, "from", "must be a version number")
+	v.Check(to > 0 && to <= math.MaxInt32, "to", "must be a version number")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fromRev, ok := app.getMovieRevision(w, r, id, int32(from))
+	if !ok {
+		return
+	}
+
+	toRev, ok := app.getMovieRevision(w, r, id, int32(to))
+	if !ok {
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"from": from, "to": to, "changes": data.DiffRevisions(fromRev, toRev)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler() restores the details a movie had at an earlier
+// version. The old version isn't reinstated; its details are saved as a new
+// version, so the history is never rewritten. Like an update, it can be made
+// conditional with an If-Match header.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(app.contextGetOrganizationID(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkIfMatch(w, r, movieETag(movie)) {
+		return
+	}
+
+	rev, ok := app.getMovieRevision(w, r, id, version)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	if v.Check(rev.Version != movie.Version, "version", "is already the current version"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rev.Apply(movie)
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
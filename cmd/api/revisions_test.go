@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestListMovieRevisions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/movies/1/revisions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `"version":2`)
+	assert.StringContains(t, body, `"title":"Test Draft"`)
+
+	code, _, _ = ts.get(t, "/v1/movies/2/revisions")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestDiffMovieRevisions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Changed fields",
+			urlPath:  "/v1/movies/1/revisions/diff?from=1&to=2",
+			wantCode: http.StatusOK,
+			wantBody: `"changes":[{"field":"title","from":"Test Draft","to":"Test Mock"},{"field":"runtime","from":"95 mins","to":"105 mins"}]`,
+		},
+		{
+			name:     "Same version",
+			urlPath:  "/v1/movies/1/revisions/diff?from=2&to=2",
+			wantCode: http.StatusOK,
+			wantBody: `"changes":[]`,
+		},
+		{
+			name:     "Missing from",
+			urlPath:  "/v1/movies/1/revisions/diff?to=2",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Version out of range",
+			urlPath:  "/v1/movies/1/revisions/diff?from=4294967297&to=2",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Unknown version",
+			urlPath:  "/v1/movies/1/revisions/diff?from=1&to=9",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRevertMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Earlier version",
+			urlPath:  "/v1/movies/1/revisions/1/revert",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Test Draft"`,
+		},
+		{
+			name:     "Current version",
+			urlPath:  "/v1/movies/1/revisions/2/revert",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "is already the current version",
+		},
+		{
+			name:     "Unknown version",
+			urlPath:  "/v1/movies/1/revisions/9/revert",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid version",
+			urlPath:  "/v1/movies/1/revisions/x/revert",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown movie",
+			urlPath:  "/v1/movies/2/revisions/1/revert",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postForm(t, tt.urlPath, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -16,17 +16,64 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requireOrganization(app.requirePermission("movies:read", app.listMoviesHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireOrganization(app.requirePermission("movies:write", app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:read", app.staticSegments(map[string]http.HandlerFunc{
+		"suggest": app.suggestMoviesHandler,
+		"stats":   app.movieStatsHandler,
+		"trash":   app.requirePermission("movies:write", app.listTrashHandler),
+	}, app.showMovieHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:write", app.requireOwnership("movies:admin", app.movieOwner, app.updateMovieHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireOrganization(app.requirePermission("movies:write", app.requireOwnership("movies:admin", app.movieOwner, app.deleteMovieHandler))))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requireOrganization(app.requirePermission("movies:write", app.requireOwnership("movies:admin", app.deletedMovieOwner, app.restoreMovieHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requireOrganization(app.requirePermission("movies:read", app.listMovieRevisionsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/diff", app.requireOrganization(app.requirePermission("movies:read", app.diffMovieRevisionsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/revert", app.requireOrganization(app.requirePermission("movies:write", app.requireOwnership("movies:admin", app.movieOwner, app.revertMovieHandler))))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/totp", app.requireActivatedUser(app.createTOTPHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/totp", app.requireActivatedUser(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/totp", app.requireActivatedUser(app.deleteTOTPHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.updateUserEmailHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/invitation", app.acceptInvitationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.listAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", app.requireAuthenticatedUser(app.deleteAllAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/email-change", app.requireActivatedUser(app.createEmailChangeTokenHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/orgs", app.requireActivatedUser(app.listOrganizationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs", app.requireActivatedUser(app.createOrganizationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/invitation", app.requireActivatedUser(app.acceptOrganizationInvitationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/orgs/:id/members", app.requireActivatedUser(app.setOrganizationMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:id/members/:user_id", app.requireActivatedUser(app.removeOrganizationMemberHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireActivatedUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireActivatedUser(app.deleteAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.updateUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.updateUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.updateUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.updateUserRolesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.updateUserActivatedHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invitations", app.requirePermission("users:admin", app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requirePermission("users:admin", app.createInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invitations/:id", app.requirePermission("users:admin", app.deleteInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions/:code/users", app.requirePermission("users:admin", app.listUsersWithPermissionHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
@@ -43,9 +90,43 @@ func (app *application) routesTest() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies",  app.listMoviesHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(map[string]http.HandlerFunc{
+		"suggest": app.suggestMoviesHandler,
+		"stats":   app.movieStatsHandler,
+		"trash":   app.listTrashHandler,
+	}, app.showMovieHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.updateMovieHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.deleteMovieHandler)
-	
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.restoreMovieHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.listMovieRevisionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/diff", app.diffMovieRevisionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/revert", app.revertMovieHandler)
 
-	return router
-}
\ No newline at end of file
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.updateUserEmailHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/invitation", app.acceptInvitationHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	return app.authenticate(router)
+}
+
+// staticSegments() serves fixed paths such as /v1/movies/suggest from the
+// /v1/movies/:id route, since httprouter won't register a static segment in
+// the same position as a named parameter. Requests whose :id matches a key in
+// static go to that handler; everything else goes to next.
+func (app *application) staticSegments(static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := static[httprouter.ParamsFromContext(r.Context()).ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -21,6 +21,15 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 	shutdownError := make(chan error)
+	// The purge loop is counted in the wait group like any background task,
+	// so shutdown waits for a purge in progress to finish.
+	stopPurge := make(chan struct{})
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.purgeTrash(stopPurge)
+	}()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -39,6 +48,8 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		close(stopPurge)
+
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
@@ -6,16 +6,31 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"greenlight.bcc/internal/data"
 	"greenlight.bcc/internal/jsonlog"
 )
 
 func newTestApplication(t *testing.T) *application {
+	var cfg config
+	cfg.limiter.rps = 2
+	cfg.limiter.burst = 4
+	cfg.limiter.enabled = true
+	cfg.cors.trustedOrigins = []string{"localhost:8080"}
+	cfg.auth.accessTokenTTL = 15 * time.Minute
+	cfg.auth.refreshTokenTTL = 24 * time.Hour
+	cfg.login.maxAttempts = 10
+	cfg.login.maxAttemptsPerIP = 100
+	cfg.login.lockoutWindow = 15 * time.Minute
+	cfg.registration.mode = registrationModeOpen
+	cfg.stats.cacheTTL = time.Minute
 
 	return &application{
-		logger: jsonlog.New(io.Discard, jsonlog.LevelFatal),
-		models: data.NewMockModels(),
+		config:     cfg,
+		logger:     jsonlog.New(io.Discard, jsonlog.LevelFatal),
+		models:     data.NewMockModels(),
+		statsCache: newTTLCache[*data.MovieStats](cfg.stats.cacheTTL),
 	}
 }
 
@@ -84,4 +99,33 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, data []byte) (int,
 	bytes.TrimSpace(body)
 
 	return rs.StatusCode, rs.Header, string(body)
-}
\ No newline at end of file
+}
+
+func (ts *testServer) putForm(t *testing.T, urlPath string, data []byte) (int, http.Header, string) {
+	return ts.sendForm(t, http.MethodPut, urlPath, data)
+}
+
+func (ts *testServer) patchForm(t *testing.T, urlPath string, data []byte) (int, http.Header, string) {
+	return ts.sendForm(t, http.MethodPatch, urlPath, data)
+}
+
+func (ts *testServer) sendForm(t *testing.T, method, urlPath string, data []byte) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/signedtoken"
+	"greenlight.bcc/internal/totp"
 	"greenlight.bcc/internal/validator"
 )
 
@@ -29,6 +32,13 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	ip := app.clientIP(r)
+
+	failures, ok := app.startLoginAttempt(w, r, input.Email, ip)
+	if !ok {
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
@@ -47,17 +57,664 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		app.notifyAccountLocked(user, failures)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.models.LoginFailures.DeleteAllForEmail(input.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user.Disabled {
+		app.accountDisabledResponse(w, r)
+		return
+	}
+
+	// The plaintext password is only available at login, so this is when a
+	// hash made with an older algorithm or cost gets replaced. A failure here
+	// shouldn't stop the user logging in; the upgrade is retried next time.
+	if user.Password.NeedsRehash() {
+		err = app.upgradePasswordHash(user, input.Password)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(user.ID, 10)})
+		}
+	}
+
+	// With two-factor authentication enabled the password alone only earns a
+	// short-lived challenge token, which is exchanged for a real token at
+	// POST /v1/tokens/two-factor along with a TOTP or recovery code.
+	if user.TOTPEnabled {
+		challenge, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactor)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"challenge_token": challenge}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.issueAuthenticationToken(w, r, user)
+}
+
+func (app *application) upgradePasswordHash(user *data.User, plaintextPassword string) error {
+	err := user.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Users.Update(user)
+}
+
+// loginThrottle() decides whether a login attempt may go ahead given the recent
+// failures. The first few failures for an account are free, after that each
+// one doubles the wait before the next attempt, and once the limit is reached
+// the account is locked for the rest of the lockout window. A limit per IP
+// address stops one client from spraying guesses across many accounts.
+func (app *application) loginThrottle(failures *data.LoginFailures) (locked bool, retryAfter time.Duration) {
+	const freeAttempts = 3
+
+	now := time.Now()
+
+	if failures.ByEmail >= app.config.login.maxAttempts {
+		if until := failures.LastByEmail.Add(app.config.login.lockoutWindow); until.After(now) {
+			return true, until.Sub(now)
+		}
+	}
+
+	if failures.ByIP >= app.config.login.maxAttemptsPerIP {
+		if until := failures.LastByIP.Add(app.config.login.lockoutWindow); until.After(now) {
+			return false, until.Sub(now)
+		}
+	}
+
+	if failures.ByEmail >= freeAttempts {
+		delay := app.config.login.lockoutWindow
+		if n := failures.ByEmail - freeAttempts; n < 20 && time.Second<<n < delay {
+			delay = time.Second << n
+		}
+		if until := failures.LastByEmail.Add(delay); until.After(now) {
+			return false, until.Sub(now)
+		}
+	}
+
+	return false, 0
+}
+
+// startLoginAttempt() counts a login attempt as failed before the credentials
+// are checked, and applies the backoff and lockout given the failures before
+// it. Counting first means parallel guesses can't all slip in under the same
+// count. A successful login takes the attempt back off again, and so does a
+// refused one so that retrying against a locked account doesn't extend the
+// lock. If the attempt is refused the response has been sent and ok is false.
+func (app *application) startLoginAttempt(w http.ResponseWriter, r *http.Request, email, ip string) (failures *data.LoginFailures, ok bool) {
+	failures, err := app.models.LoginFailures.Insert(email, ip, time.Now().Add(-app.config.login.lockoutWindow))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if locked, retryAfter := app.loginThrottle(failures); retryAfter > 0 {
+		err = app.models.LoginFailures.Delete(email, ip)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+
+		if locked {
+			app.accountLockedResponse(w, r, retryAfter)
+		} else {
+			app.loginThrottledResponse(w, r, retryAfter)
+		}
+		return nil, false
+	}
+
+	return failures, true
+}
+
+// notifyAccountLocked() emails the account owner if the failed attempt that
+// started with the given failures is the one that takes their account over
+// the limit.
+func (app *application) notifyAccountLocked(user *data.User, failures *data.LoginFailures) {
+	limit := app.config.login.maxAttempts
+	if failures.ByEmail >= limit || failures.ByEmail+1 < limit {
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"lockedUntil": time.Now().Add(app.config.login.lockoutWindow).UTC().Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+// maxTwoFactorAttempts is the number of wrong codes accepted for a two-factor
+// challenge before it's revoked.
+const maxTwoFactorAttempts = 5
+
+func (app *application) createTwoFactorAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.ChallengeToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must be provided")
+	v.Check(input.Code == "" || input.RecoveryCode == "", "code", "must not be provided together with recovery_code")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactor, input.ChallengeToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("challenge_token", "invalid or expired challenge token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Wrong codes count as failed logins, so they're subject to the same
+	// backoff and lockout as wrong passwords. The failures were cleared when
+	// the password was accepted, so the count is the misses since then.
+	ip := app.clientIP(r)
+
+	failures, ok := app.startLoginAttempt(w, r, user.Email, ip)
+	if !ok {
+		return
+	}
+
+	var match bool
+	if input.Code != "" {
+		var counter int64
+		counter, match = totp.Validate(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastCounter)
+		if match {
+			// Saving the counter is what stops the code being replayed. If a
+			// concurrent request got there first, the update is an edit
+			// conflict and this attempt fails.
+			user.TOTPLastCounter = counter
+
+			err = app.models.Users.Update(user)
+			if err != nil && !errors.Is(err, data.ErrEditConflict) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			match = err == nil
+		}
+	} else {
+		match, err = app.models.RecoveryCodes.Consume(user.ID, input.RecoveryCode)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !match {
+		app.notifyAccountLocked(user, failures)
+
+		// After too many misses the challenge is burned and the user has to
+		// log in with their password again.
+		if failures.ByEmail+1 >= maxTwoFactorAttempts {
+			err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.LoginFailures.DeleteAllForEmail(user.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user.Disabled {
+		app.accountDisabledResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.issueAuthenticationToken(w, r, user)
+}
+
+// issueAuthenticationToken() sends the response for a successful login, in
+// whichever form the configured token mode uses.
+func (app *application) issueAuthenticationToken(w http.ResponseWriter, r *http.Request, user *data.User) {
+	if app.config.auth.tokenMode == tokenModeSigned {
+		// A signed token can be bound to an organization by sending the X-Org
+		// header when logging in, so later requests don't need to repeat it.
+		var orgID int64
+		if header := r.Header.Get("X-Org"); header != "" {
+			id, err := strconv.ParseInt(header, 10, 64)
+			if err != nil || id < 1 {
+				app.badRequestResponse(w, r, errors.New("invalid X-Org header"))
+				return
+			}
+
+			_, err = app.models.Organizations.GetMembership(id, user.ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.notMemberResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			orgID = id
+		}
+
+		token, err := app.newSignedAuthenticationToken(user, orgID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, refreshToken, err := app.models.Tokens.NewSession(user.ID, app.config.auth.accessTokenTTL, app.config.auth.refreshTokenTTL, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newSignedAuthenticationToken() issues a stateless token for the signed token
+// mode. These can't be revoked or refreshed, so they use the access token TTL.
+// Logging out, deactivating the account or resetting the password doesn't
+// invalidate one either; it stays usable until it expires.
+func (app *application) newSignedAuthenticationToken(user *data.User, orgID int64) (*data.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTokenTTL)
+
+	plaintext, err := app.signer.Sign(signedtoken.Claims{
+		UserID:         user.ID,
+		Scope:          data.ScopeAuthentication,
+		Activated:      user.Activated,
+		OrganizationID: orgID,
+		IssuedAt:       now.Unix(),
+		Expiry:         expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: plaintext,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, refreshToken, err := app.models.Tokens.Rotate(input.RefreshToken, app.config.auth.accessTokenTTL, app.config.auth.refreshTokenTTL, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.PrintInfo("refresh token reused, token family revoked", map[string]string{
+				"ip_address": app.clientIP(r),
+			})
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The response is the same whether or not the email matches an activated
+	// account, so the endpoint can't be used to discover registered addresses.
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err != nil || !user.Activated {
+		err = app.writeJSON(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// As with password resets, unknown, already activated and disabled accounts
+	// get the same response as a successful request, they just don't receive an
+	// email.
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err != nil || user.Activated || user.Disabled {
+		err = app.writeJSON(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+		}
+
+		err = app.mailer.Send(user.Email, "token_activation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createEmailChangeTokenHandler() records the requested address as pending and
+// sends a confirmation token to it. The account keeps its current email until
+// the token is redeemed with PUT /v1/users/email.
+func (app *application) createEmailChangeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.verifyCurrentPassword(w, r, user, input.CurrentPassword) {
+		return
+	}
+
+	if input.Email == user.Email {
+		v.AddError("email", "must be different from the current email address")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user.PendingEmail = input.Email
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the most recent request can be confirmed.
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"emailChangeToken": token.Plaintext,
+		}
+
+		err = app.mailer.Send(user.PendingEmail, "token_email_change.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{"message": "an email will be sent to the new address containing confirmation instructions"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// In the signed token mode nothing is stored per token, so there are no
+// sessions to list or revoke. The session handlers below refuse the request
+// rather than report success, since a signed token stays valid until it
+// expires whatever they do.
+
+func (app *application) listAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.auth.tokenMode == tokenModeSigned {
+		app.signedTokenSessionsResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetAllSessionsForUser(user.ID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.auth.tokenMode == tokenModeSigned {
+		app.signedTokenSessionsResponse(w, r)
+		return
+	}
+
+	// A request authenticated with an API key carries no session token, so
+	// there would be nothing to delete.
+	token := app.contextGetToken(r)
+	if token == "" {
+		app.apiKeyLogoutResponse(w, r)
+		return
+	}
+
+	err := app.models.Tokens.Delete(data.ScopeAuthentication, token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.auth.tokenMode == tokenModeSigned {
+		app.signedTokenSessionsResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		err := app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out of all sessions"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
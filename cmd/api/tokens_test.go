@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/signedtoken"
+)
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Email    string
+		wantCode int
+	}{
+		{
+			name:     "Existing email",
+			Email:    "example@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "nobody@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Invalid email",
+			Email:    "example",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "test for wrong input",
+			Email:    "example@gmail.com",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Email string `json:"email"`
+			}{
+				Email: tt.Email,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+			if tt.name == "test for wrong input" {
+				b = append(b, 'a')
+			}
+
+			code, _, body := ts.postForm(t, "/v1/tokens/password-reset", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCreateActivationToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		Email    string
+		wantCode int
+	}{
+		{
+			name:     "Inactive account",
+			Email:    "inactive@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Already activated account",
+			Email:    "example@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Account deactivated by an administrator",
+			Email:    "disabled@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "nobody@gmail.com",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "Empty email",
+			Email:    "",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Email string `json:"email"`
+			}{
+				Email: tt.Email,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForm(t, "/v1/tokens/activation", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAuthenticationTokenSessions(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		handler    http.HandlerFunc
+		authHeader string
+		wantCode   int
+	}{
+		{
+			name:       "List sessions",
+			method:     http.MethodGet,
+			handler:    app.listAuthenticationTokensHandler,
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Log out",
+			method:     http.MethodDelete,
+			handler:    app.deleteAuthenticationTokenHandler,
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Log out everywhere",
+			method:     http.MethodDelete,
+			handler:    app.deleteAllAuthenticationTokensHandler,
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "Log out with an API key",
+			method:     http.MethodDelete,
+			handler:    app.deleteAuthenticationTokenHandler,
+			authHeader: "ApiKey gl_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:     "Anonymous log out",
+			method:   http.MethodDelete,
+			handler:  app.deleteAuthenticationTokenHandler,
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerToTest := app.authenticate(app.requireAuthenticatedUser(tt.handler))
+
+			req := httptest.NewRequest(tt.method, "/v1/tokens/authentication", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestAuthenticationTokenSessionsSigned(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.auth.tokenMode = tokenModeSigned
+
+	var err error
+	app.signer, err = signedtoken.New(map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.newSignedAuthenticationToken(&data.User{ID: 1, Activated: true}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"List sessions":      app.listAuthenticationTokensHandler,
+		"Log out":            app.deleteAuthenticationTokenHandler,
+		"Log out everywhere": app.deleteAllAuthenticationTokensHandler,
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			handlerToTest := app.authenticate(app.requireAuthenticatedUser(handler))
+
+			req := httptest.NewRequest(http.MethodDelete, "/v1/tokens/authentication", nil)
+			req.Header.Set("Authorization", "Bearer "+token.Plaintext)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusNotImplemented)
+			assert.StringContains(t, rr.Body.String(), "can't be listed or revoked")
+		})
+	}
+}
+
+func TestRefreshAuthenticationToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		RefreshToken string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:         "Valid refresh token",
+			RefreshToken: "cccccccccccccccccccccccccc",
+			wantCode:     http.StatusCreated,
+			wantBody:     "refresh_token",
+		},
+		{
+			name:         "Reused refresh token",
+			RefreshToken: "dddddddddddddddddddddddddd",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "Unknown refresh token",
+			RefreshToken: "aaaaaaaaaaaaaaaaaaaaaaaaaa",
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "Malformed refresh token",
+			RefreshToken: "abc",
+			wantCode:     http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				RefreshToken string `json:"refresh_token"`
+			}{
+				RefreshToken: tt.RefreshToken,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForm(t, "/v1/tokens/refresh", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreateTwoFactorAuthenticationToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validChallenge = "eeeeeeeeeeeeeeeeeeeeeeeeee"
+
+	tests := []struct {
+		name           string
+		ChallengeToken string
+		Code           string
+		RecoveryCode   string
+		wantCode       int
+	}{
+		{
+			name:           "Valid recovery code",
+			ChallengeToken: validChallenge,
+			RecoveryCode:   "aaaa-bbbb-cccc-dddd",
+			wantCode:       http.StatusCreated,
+		},
+		{
+			name:           "Wrong recovery code",
+			ChallengeToken: validChallenge,
+			RecoveryCode:   "aaaa-bbbb-cccc-eeee",
+			wantCode:       http.StatusUnauthorized,
+		},
+		{
+			name:           "Wrong TOTP code",
+			ChallengeToken: validChallenge,
+			Code:           "000000",
+			wantCode:       http.StatusUnauthorized,
+		},
+		{
+			name:           "Throttled after wrong codes",
+			ChallengeToken: "kkkkkkkkkkkkkkkkkkkkkkkkkk",
+			Code:           "000000",
+			wantCode:       http.StatusTooManyRequests,
+		},
+		{
+			name:           "Unknown challenge token",
+			ChallengeToken: "aaaaaaaaaaaaaaaaaaaaaaaaaa",
+			Code:           "000000",
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "No code",
+			ChallengeToken: validChallenge,
+			wantCode:       http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				ChallengeToken string `json:"challenge_token"`
+				Code           string `json:"code,omitempty"`
+				RecoveryCode   string `json:"recovery_code,omitempty"`
+			}{
+				ChallengeToken: tt.ChallengeToken,
+				Code:           tt.Code,
+				RecoveryCode:   tt.RecoveryCode,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, _, body := ts.postForm(t, "/v1/tokens/two-factor", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	const validPassword = "QWERTY549"
+
+	tests := []struct {
+		name     string
+		Email    string
+		Password string
+		wantCode int
+	}{
+		{
+			name:     "Valid credentials with a legacy bcrypt hash",
+			Email:    "example@gmail.com",
+			Password: "pa55word",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Wrong password",
+			Email:    "example@gmail.com",
+			Password: validPassword,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown email",
+			Email:    "nobody@gmail.com",
+			Password: validPassword,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Account deactivated by an administrator",
+			Email:    "disabled@gmail.com",
+			Password: "pa55word",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Locked account",
+			Email:    "locked@gmail.com",
+			Password: validPassword,
+			wantCode: http.StatusLocked,
+		},
+		{
+			name:     "Throttled account",
+			Email:    "throttled@gmail.com",
+			Password: validPassword,
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Short password",
+			Email:    "example@gmail.com",
+			Password: "qwerty",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				Email    string `json:"email"`
+				Password string `json:"password"`
+			}{
+				Email:    tt.Email,
+				Password: tt.Password,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			code, header, body := ts.postForm(t, "/v1/tokens/authentication", b)
+			t.Log(body)
+			assert.Equal(t, code, tt.wantCode)
+
+			if code == http.StatusLocked || code == http.StatusTooManyRequests {
+				assert.Equal(t, header.Get("Retry-After") != "", true)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/totp"
+	"greenlight.bcc/internal/validator"
+)
+
+// The user in the request context may only be a snapshot from a signed token,
+// so each of these handlers reloads the full record before changing it.
+//
+// Changing the second factor can lock the owner out of the account, so these
+// handlers refuse API keys and ask for the current password, in case the
+// session or key has been stolen.
+
+func (app *application) createTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetAPIKey(r) != nil {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.verifyCurrentPassword(w, r, user, input.CurrentPassword) {
+		return
+	}
+
+	if user.TOTPEnabled {
+		v := validator.New()
+		v.AddError("totp", "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user.TOTPSecret = secret
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"totp": map[string]string{
+			"secret": secret,
+			"uri":    totp.URI("Greenlight", user.Email, secret),
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetAPIKey(r) != nil {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.verifyCurrentPassword(w, r, user, input.CurrentPassword) {
+		return
+	}
+
+	v := validator.New()
+	v.Check(user.TOTPSecret != "", "totp", "two-factor enrollment has not been started")
+	v.Check(!user.TOTPEnabled, "totp", "two-factor authentication is already enabled")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	counter, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastCounter)
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	codes, err := app.models.RecoveryCodes.New(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if app.contextGetAPIKey(r) != nil {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.verifyCurrentPassword(w, r, user, input.CurrentPassword) {
+		return
+	}
+
+	v := validator.New()
+	v.Check(user.TOTPEnabled, "totp", "two-factor authentication is not enabled")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The counter is kept after two-factor authentication is turned off, so
+	// the code used here can't be replayed if it's turned back on.
+	counter, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastCounter)
+	if !ok {
+		v.AddError("code", "invalid or expired code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastCounter = counter
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.RecoveryCodes.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
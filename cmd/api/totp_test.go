@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestCreateTOTP(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name            string
+		CurrentPassword string
+		authHeader      string
+		wantCode        int
+	}{
+		{
+			name:            "Valid submission",
+			CurrentPassword: "pa55word",
+			authHeader:      "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:        http.StatusCreated,
+		},
+		{
+			name:       "Current password not provided",
+			authHeader: "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "Wrong current password",
+			CurrentPassword: "wrongpassword",
+			authHeader:      "Bearer bbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:        http.StatusUnauthorized,
+		},
+		{
+			name:            "Authenticated with an API key",
+			CurrentPassword: "pa55word",
+			authHeader:      "ApiKey gl_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			wantCode:        http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputData := struct {
+				CurrentPassword string `json:"current_password"`
+			}{
+				CurrentPassword: tt.CurrentPassword,
+			}
+
+			b, err := json.Marshal(&inputData)
+			if err != nil {
+				t.Fatal("wrong input data")
+			}
+
+			handlerToTest := app.authenticate(app.requireActivatedUser(app.createTOTPHandler))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/totp", bytes.NewReader(b))
+			req.Header.Set("Authorization", tt.authHeader)
+			rr := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(rr, req)
+
+			t.Log(rr.Body.String())
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"greenlight.bcc/internal/data"
+	"greenlight.bcc/internal/validator"
+)
+
+// listTrashHandler() lists the organization's deleted movies, most recently
+// deleted first by default.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(app.contextGetOrganizationID(r), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeListJSON(w, r, envelope{"movies": movies, "metadata": metadata})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deletedMovieOwner() is the ownerFunc for movies in the trash.
+func (app *application) deletedMovieOwner(r *http.Request) (int64, error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return 0, data.ErrRecordNotFound
+	}
+
+	movie, err := app.models.Movies.GetDeleted(app.contextGetOrganizationID(r), id)
+	if err != nil {
+		return 0, err
+	}
+
+	return movie.CreatedBy, nil
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.GetDeleted(app.contextGetOrganizationID(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Movies.Restore(movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash() permanently deletes movies that have been in the trash for
+// longer than the configured retention period, checking every interval until
+// stop is closed. A retention of zero keeps deleted movies forever. Each purge
+// runs to completion before the next wait, so purges never overlap.
+func (app *application) purgeTrash(stop <-chan struct{}) {
+	if app.config.trash.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.models.Movies.PurgeDeleted(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if purged > 0 {
+			app.logger.PrintInfo("purged movies from the trash", map[string]string{
+				"count": strconv.FormatInt(purged, 10),
+			})
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+func TestListTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Default sort",
+			urlPath:  "/v1/movies/trash",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"Deleted Mock"`,
+		},
+		{
+			name:     "Invalid sort",
+			urlPath:  "/v1/movies/trash?sort=year",
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRestoreMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routesTest())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Movie in the trash",
+			urlPath:  "/v1/movies/5/restore",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Movie not in the trash",
+			urlPath:  "/v1/movies/1/restore",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Negative ID",
+			urlPath:  "/v1/movies/-1/restore",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postForm(t, tt.urlPath, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.StringContains(t, body, `"title":"Deleted Mock"`)
+				if strings.Contains(body, "deleted_at") {
+					t.Errorf("restored movie still has deleted_at: %s", body)
+				}
+			}
+		})
+	}
+}
+
+func TestPurgeTrashStops(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.trash.retention = time.Hour
+	app.config.trash.purgeInterval = time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		app.purgeTrash(stop)
+		close(done)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purgeTrash() didn't return after stop was closed")
+	}
+	app.wg.Wait()
+}
@@ -12,6 +12,7 @@ require (
 )
 
 require (
+	golang.org/x/sys v0.7.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
 )
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+const apiKeyPrefix = "gl_"
+
+// APIKey is a long-lived credential for non-interactive clients. Like tokens,
+// only a hash of the key is stored and the plaintext is shown once on creation.
+// If Permissions is empty the key carries all of its owner's permissions,
+// otherwise it is limited to the listed subset.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	UserID      int64       `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+}
+
+func generateAPIKey(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key := &APIKey{
+		Name:        name,
+		UserID:      userID,
+		Permissions: permissions,
+		Expiry:      expiry,
+	}
+
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = apiKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	return key, nil
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(keyPlaintext != "", "key", "must be provided")
+	v.Check(strings.HasPrefix(keyPlaintext, apiKeyPrefix), "key", "must start with "+apiKeyPrefix)
+	v.Check(len(keyPlaintext) == len(apiKeyPrefix)+32, "key", "must be 35 bytes long")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+func (m APIKeyModel) New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, permissions, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO api_keys (user_id, name, hash, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Hash, pq.Array(key.Permissions), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+	SELECT id, created_at, name, user_id, permissions, expiry, last_used_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.Name,
+			&key.UserID,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey() looks up an unexpired API key together with the user it belongs
+// to, skipping keys of disabled accounts, and records the key as used. As with TokenModel.Touch(), the timestamp is
+// only written once a minute per key, so most requests don't cause a write.
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*User, *APIKey, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+	WITH key AS (
+		SELECT users.id AS user_id, users.created_at AS user_created_at, users.name AS user_name, users.email,
+		users.password_hash, users.activated, users.disabled, users.version, users.totp_secret, users.totp_enabled, users.totp_last_counter, users.pending_email,
+		api_keys.id, api_keys.created_at, api_keys.name, api_keys.permissions, api_keys.expiry, api_keys.last_used_at
+		FROM api_keys
+		INNER JOIN users ON users.id = api_keys.user_id
+		WHERE api_keys.hash = $1
+		AND NOT users.disabled
+		AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)
+	), touched AS (
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		FROM key
+		WHERE api_keys.id = key.id
+		AND (key.last_used_at IS NULL OR key.last_used_at < NOW() - INTERVAL '1 minute')
+	)
+	SELECT user_id, user_created_at, user_name, email, password_hash, activated, disabled, version,
+	totp_secret, totp_enabled, totp_last_counter, pending_email, id, created_at, name, permissions, expiry, last_used_at
+	FROM key`
+
+	var user User
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:], time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Disabled,
+		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastCounter,
+		&user.PendingEmail,
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key.UserID = user.ID
+
+	return &user, &key, nil
+}
+
+func (m APIKeyModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser() revokes every API key belonging to a user.
+func (m APIKeyModel) DeleteAllForUser(userID int64) error {
+	query := `
+	DELETE FROM api_keys
+	WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+type MockAPIKeyModel struct{}
+
+func (m MockAPIKeyModel) New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, permissions, expiry)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = 1
+	key.CreatedAt = time.Now()
+	return key, nil
+}
+
+func (m MockAPIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	return []*APIKey{}, nil
+}
+
+func (m MockAPIKeyModel) GetForKey(keyPlaintext string) (*User, *APIKey, error) {
+	switch keyPlaintext {
+	case "gl_bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb":
+		return mockUser(), &APIKey{ID: 1, Name: "importer", UserID: 1, Permissions: Permissions{"movies:read"}}, nil
+	default:
+		return nil, nil, ErrRecordNotFound
+	}
+}
+
+func (m MockAPIKeyModel) Delete(id, userID int64) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+func (m MockAPIKeyModel) DeleteAllForUser(userID int64) error {
+	return nil
+}
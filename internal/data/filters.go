@@ -3,12 +3,25 @@ package data
 import "greenlight.bcc/internal/validator"
 import "strings"
 import "math"
+import "encoding/base64"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "strconv"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
 
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Cursor is the next_cursor from a previous page. When it's set, the
+	// page starts after the row the cursor points at instead of at an offset.
+	Cursor string
+	// IncludeTotal asks for the total number of matching records, which
+	// costs a count over every match.
+	IncludeTotal bool
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -18,6 +31,83 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		v.Check(f.Page == 1, "cursor", "cannot be combined with page")
+
+		c, err := f.cursor()
+		switch {
+		case err != nil:
+			v.AddError("cursor", "must be a next_cursor value from a previous response")
+		case c.Sort != f.Sort:
+			v.AddError("cursor", "was issued for a different sort order")
+		case validator.PermittedValue(f.Sort, f.SortSafelist...) && !c.validValue(f.sortColumn()):
+			v.AddError("cursor", "is invalid")
+		}
+	}
+}
+
+// cursor is the decoded form of Filters.Cursor. It records the sort column
+// value and ID of the last row on the previous page; because every query
+// breaks ties on id, the pair identifies a unique position in the ordering.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// validValue() reports whether the cursor's value parses as the type of the
+// sort column, so a tampered cursor is rejected before it reaches the query.
+func (c cursor) validValue(column string) bool {
+	var err error
+
+	switch column {
+	case "id":
+		_, err = strconv.ParseInt(c.Value, 10, 64)
+	case "year", "runtime":
+		_, err = strconv.ParseInt(c.Value, 10, 32)
+	case "relevance":
+		_, err = strconv.ParseFloat(c.Value, 64)
+	}
+
+	return err == nil
+}
+
+func (f Filters) cursor() (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// keysetCondition() returns the WHERE condition selecting the rows after the
+// cursor, for a query ordered by the sort column and then id ascending. The
+// cursor's value and ID are bound to the placeholders $valuePos and $idPos.
+func (f Filters) keysetCondition(valuePos, idPos int) string {
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	column := f.sortColumn()
+	return fmt.Sprintf("(%s %s $%d OR (%s = $%d AND id > $%d))", column, op, valuePos, column, valuePos, idPos)
 }
 
 func (f Filters) sortColumn() string {
@@ -30,6 +120,10 @@ func (f Filters) sortColumn() string {
 }
 
 func (f Filters) sortDirection() string {
+	// Relevance is a score, so it's always listed best match first.
+	if f.Sort == "relevance" {
+		return "DESC"
+	}
 	if strings.HasPrefix(f.Sort, "-") {
 		return "DESC"
 	}
@@ -41,15 +135,19 @@ func (f Filters) limit() int {
 }
 
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
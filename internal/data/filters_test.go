@@ -0,0 +1,119 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/validator"
+)
+
+var movieSortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+func TestFiltersCursor(t *testing.T) {
+	want := cursor{Sort: "-year", Value: "1999", ID: 42}
+	f := Filters{Sort: "-year", Cursor: encodeCursor(want)}
+
+	got, err := f.cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("cursor() = %+v; want %+v", got, want)
+	}
+
+	for _, bad := range []string{"not base64!", "bm90IGpzb24", encodeCursor(cursor{Sort: "id"})} {
+		f.Cursor = bad
+		if _, err := f.cursor(); err != ErrInvalidCursor {
+			t.Errorf("cursor() with %q: got error %v; want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestFiltersKeysetCondition(t *testing.T) {
+	for _, tt := range []struct {
+		sort string
+		want string
+	}{
+		{"title", "(title > $6 OR (title = $6 AND id > $7))"},
+		{"-year", "(year < $6 OR (year = $6 AND id > $7))"},
+		{"id", "(id > $6 OR (id = $6 AND id > $7))"},
+	} {
+		f := Filters{Sort: tt.sort, SortSafelist: movieSortSafelist}
+		if got := f.keysetCondition(6, 7); got != tt.want {
+			t.Errorf("keysetCondition() for %q = %q; want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	valid := encodeCursor(cursor{Sort: "title", Value: "Up", ID: 3})
+
+	for _, tt := range []struct {
+		name    string
+		filters Filters
+		valid   bool
+	}{
+		{"Matching sort", Filters{Page: 1, PageSize: 20, Sort: "title", Cursor: valid}, true},
+		{"Different sort", Filters{Page: 1, PageSize: 20, Sort: "-title", Cursor: valid}, false},
+		{"Combined with page", Filters{Page: 2, PageSize: 20, Sort: "title", Cursor: valid}, false},
+		{"Malformed", Filters{Page: 1, PageSize: 20, Sort: "title", Cursor: "abc"}, false},
+		{"Value of the wrong type", Filters{Page: 1, PageSize: 20, Sort: "year", Cursor: encodeCursor(cursor{Sort: "year", Value: "Up", ID: 3})}, false},
+		{"Value out of range", Filters{Page: 1, PageSize: 20, Sort: "-runtime", Cursor: encodeCursor(cursor{Sort: "-runtime", Value: "4294967296", ID: 3})}, false},
+		{"Numeric value", Filters{Page: 1, PageSize: 20, Sort: "year", Cursor: encodeCursor(cursor{Sort: "year", Value: "1999", ID: 3})}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.SortSafelist = movieSortSafelist
+
+			v := validator.New()
+			ValidateFilters(v, tt.filters)
+			if v.Valid() != tt.valid {
+				t.Errorf("Valid() = %v; want %v (errors %v)", v.Valid(), tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestMovieFiltersArgs(t *testing.T) {
+	args := MovieFilters{}.args(1)
+	if len(args) != movieFiltersArgs {
+		t.Errorf("args() returned %d values; movieFilters uses %d placeholders", len(args), movieFiltersArgs)
+	}
+}
+
+func TestPrefixTSQuery(t *testing.T) {
+	for _, tt := range []struct {
+		search string
+		want   string
+	}{
+		{"godf", "godf:*"},
+		{"The  Godf", "the:* & godf:*"},
+		{"it's a bug's life!", "it:* & s:* & a:* & bug:* & s:* & life:*"},
+		{"x & !y | (z:*)", "x:* & y:* & z:*"},
+		{"", ""},
+	} {
+		if got := prefixTSQuery(tt.search); got != tt.want {
+			t.Errorf("prefixTSQuery(%q) = %q; want %q", tt.search, got, tt.want)
+		}
+	}
+}
+
+func TestMovieFiltersCacheKey(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	afterElsewhere := after.In(time.FixedZone("UTC+5", 5*60*60))
+
+	a := MovieFilters{Title: "alien", Genres: []string{"sci-fi", "horror"}, YearMin: 1979, CreatedAfter: &after}
+	b := MovieFilters{Title: "alien", Genres: []string{"horror", "sci-fi"}, YearMin: 1979, CreatedAfter: &afterElsewhere}
+	if a.CacheKey() != b.CacheKey() {
+		t.Errorf("CacheKey() differs for equivalent filters: %q and %q", a.CacheKey(), b.CacheKey())
+	}
+
+	for _, other := range []MovieFilters{
+		{Title: "alien", Genres: []string{"sci-fi", "horror"}, YearMin: 1979},
+		{Title: "alien", GenresAny: []string{"sci-fi", "horror"}, YearMin: 1979, CreatedAfter: &after},
+		{Title: "alien", Genres: []string{"sci-fi", "horror"}, YearMax: 1979, CreatedAfter: &after},
+	} {
+		if a.CacheKey() == other.CacheKey() {
+			t.Errorf("CacheKey() is %q for different filters", a.CacheKey())
+		}
+	}
+}
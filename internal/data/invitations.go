@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+// Invitation lets an administrator sign somebody up when open registration is
+// disabled. Accepting it creates an activated account for Email holding the
+// listed permission codes, which joins the default organization like any new
+// account. As with tokens, only a hash of the code is stored.
+type Invitation struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Email       string      `json:"email"`
+	Plaintext   string      `json:"-"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      time.Time   `json:"expiry"`
+	InvitedBy   int64       `json:"invited_by,omitempty"`
+}
+
+func generateInvitation(email string, permissions Permissions, expiry time.Time, invitedBy int64) (*Invitation, error) {
+	invitation := &Invitation{
+		Email:       email,
+		Permissions: permissions,
+		Expiry:      expiry,
+		InvitedBy:   invitedBy,
+	}
+
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(invitation.Plaintext))
+	invitation.Hash = hash[:]
+
+	return invitation, nil
+}
+
+// ValidateInvitation() checks the invitation, including that every permission
+// code is one of the known codes.
+func ValidateInvitation(v *validator.Validator, invitation *Invitation, known Permissions) {
+	ValidateEmail(v, invitation.Email)
+	v.Check(validator.Unique(invitation.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range invitation.Permissions {
+		v.Check(validator.PermittedValue(code, known...), "permissions", fmt.Sprintf("%q is not a known permission code", code))
+	}
+	v.Check(invitation.Expiry.After(time.Now()), "expiry", "must be in the future")
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+func (m InvitationModel) New(email string, permissions Permissions, expiry time.Time, invitedBy int64) (*Invitation, error) {
+	invitation, err := generateInvitation(email, permissions, expiry, invitedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO invitations (email, hash, permissions, expiry, invited_by)
+	VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+	RETURNING id, created_at`
+
+	args := []any{invitation.Email, invitation.Hash, pq.Array(invitation.Permissions), invitation.Expiry, invitation.InvitedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (m InvitationModel) GetAll() ([]*Invitation, error) {
+	query := `
+	SELECT id, created_at, email, permissions, expiry, coalesce(invited_by, 0)
+	FROM invitations
+	WHERE expiry > $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.Email,
+			pq.Array(&invitation.Permissions),
+			&invitation.Expiry,
+			&invitation.InvitedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &invitation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// GetForToken() looks up an unexpired invitation from its plaintext code.
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT id, created_at, email, permissions, expiry, coalesce(invited_by, 0)
+	FROM invitations
+	WHERE hash = $1 AND expiry > $2`
+
+	var invitation Invitation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.Email,
+		pq.Array(&invitation.Permissions),
+		&invitation.Expiry,
+		&invitation.InvitedBy,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// DeleteAllForEmail() removes every invitation sent to the address, so that
+// once one is accepted any others can't be used to create a second account.
+func (m InvitationModel) DeleteAllForEmail(email string) error {
+	query := `
+	DELETE FROM invitations
+	WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email)
+	return err
+}
+
+func (m InvitationModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM invitations
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type MockInvitationModel struct{}
+
+func (m MockInvitationModel) New(email string, permissions Permissions, expiry time.Time, invitedBy int64) (*Invitation, error) {
+	invitation, err := generateInvitation(email, permissions, expiry, invitedBy)
+	if err != nil {
+		return nil, err
+	}
+	invitation.ID = 1
+	invitation.CreatedAt = time.Now()
+	return invitation, nil
+}
+
+func (m MockInvitationModel) GetAll() ([]*Invitation, error) {
+	return []*Invitation{}, nil
+}
+
+func (m MockInvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	switch tokenPlaintext {
+	case "iiiiiiiiiiiiiiiiiiiiiiiiii":
+		return &Invitation{
+			ID:          1,
+			CreatedAt:   time.Now(),
+			Email:       "invited@gmail.com",
+			Permissions: Permissions{"movies:read", "movies:write"},
+			Expiry:      time.Now().Add(24 * time.Hour),
+		}, nil
+	case "jjjjjjjjjjjjjjjjjjjjjjjjjj":
+		return &Invitation{
+			ID:          2,
+			CreatedAt:   time.Now(),
+			Email:       "baha@gmail.com",
+			Permissions: Permissions{"movies:read"},
+			Expiry:      time.Now().Add(24 * time.Hour),
+		}, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
+
+func (m MockInvitationModel) DeleteAllForEmail(email string) error {
+	return nil
+}
+
+func (m MockInvitationModel) Delete(id int64) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return ErrRecordNotFound
+	}
+}
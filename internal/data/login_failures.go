@@ -0,0 +1,135 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// LoginFailures summarises the recent failed logins for an email address and
+// for the client IP address making the attempt.
+type LoginFailures struct {
+	ByEmail     int
+	LastByEmail time.Time
+	ByIP        int
+	LastByIP    time.Time
+}
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Insert() counts a login attempt as failed and returns the failures recorded
+// before it. The counters are bumped with a single upsert, so concurrent
+// attempts are serialised on the counter rows and each one sees the count left
+// by the attempt before it. A counter starts again from one when its previous
+// failure is older than since, and counters idle for more than a day are
+// cleared out at the same time.
+func (m LoginFailureModel) Insert(email, ipAddress string, since time.Time) (*LoginFailures, error) {
+	query := `
+	WITH purged AS (
+		DELETE FROM login_failure_counts
+		WHERE last_failed_at < NOW() - INTERVAL '1 day'
+		AND key NOT IN ('email:' || lower($1), 'ip:' || $2)
+	)
+	INSERT INTO login_failure_counts AS c (key, count, last_failed_at, previous_failed_at)
+	VALUES ('email:' || lower($1), 1, NOW(), 'epoch'), ('ip:' || $2, 1, NOW(), 'epoch')
+	ON CONFLICT (key) DO UPDATE SET
+		count = CASE WHEN c.last_failed_at > $3 THEN c.count + 1 ELSE 1 END,
+		previous_failed_at = c.last_failed_at,
+		last_failed_at = NOW()
+	RETURNING c.key, c.count - 1, c.previous_failed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, email, ipAddress, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures LoginFailures
+
+	for rows.Next() {
+		var (
+			key   string
+			count int
+			last  time.Time
+		)
+
+		err := rows.Scan(&key, &count, &last)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(key, "email:") {
+			failures.ByEmail, failures.LastByEmail = count, last
+		} else {
+			failures.ByIP, failures.LastByIP = count, last
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// Delete() takes back an attempt counted by Insert() that was refused before
+// the credentials were checked, so that retrying against a locked account
+// doesn't extend the lock.
+func (m LoginFailureModel) Delete(email, ipAddress string) error {
+	query := `
+	UPDATE login_failure_counts
+	SET count = count - 1, last_failed_at = previous_failed_at
+	WHERE key IN ('email:' || lower($1), 'ip:' || $2) AND count > 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, ipAddress)
+	return err
+}
+
+// DeleteAllForEmail() resets the failure count for an account after a
+// successful login, and takes the successful attempt back off the count for
+// the IP address.
+func (m LoginFailureModel) DeleteAllForEmail(email, ipAddress string) error {
+	query := `
+	WITH ip AS (
+		UPDATE login_failure_counts
+		SET count = count - 1, last_failed_at = previous_failed_at
+		WHERE key = 'ip:' || $2 AND count > 0
+	)
+	DELETE FROM login_failure_counts
+	WHERE key = 'email:' || lower($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email, ipAddress)
+	return err
+}
+
+type MockLoginFailureModel struct{}
+
+func (m MockLoginFailureModel) Insert(email, ipAddress string, since time.Time) (*LoginFailures, error) {
+	switch email {
+	case "locked@gmail.com":
+		return &LoginFailures{ByEmail: 10, LastByEmail: time.Now()}, nil
+	case "throttled@gmail.com":
+		return &LoginFailures{ByEmail: 5, LastByEmail: time.Now()}, nil
+	default:
+		return &LoginFailures{}, nil
+	}
+}
+
+func (m MockLoginFailureModel) Delete(email, ipAddress string) error {
+	return nil
+}
+
+func (m MockLoginFailureModel) DeleteAllForEmail(email, ipAddress string) error {
+	return nil
+}
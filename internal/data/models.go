@@ -14,42 +14,119 @@ var (
 type Models struct {
 	Movies interface {
 		Insert(movie *Movie) error
-		Get(id int64) (*Movie, error)
-		Update(movie *Movie) error
-		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		Get(orgID, id int64) (*Movie, error)
+		Update(movie *Movie, userID int64) error
+		Delete(orgID, id int64, version int32) error
+		GetDeleted(orgID, id int64) (*Movie, error)
+		Restore(movie *Movie) error
+		GetAllDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error)
+		PurgeDeleted(before time.Time) (int64, error)
+		GetAll(orgID int64, mf MovieFilters, filters Filters) ([]*Movie, Metadata, error)
+		Suggest(orgID int64, prefix string, limit int) ([]string, error)
+		GetFacets(orgID int64, mf MovieFilters, names []string) (Facets, error)
+		GetStats(orgID int64, mf MovieFilters) (*MovieStats, error)
+	}
+	MovieRevisions interface {
+		GetAllForMovie(orgID, movieID int64) ([]*MovieRevision, error)
+		Get(orgID, movieID int64, version int32) (*MovieRevision, error)
 	}
 	Users interface {
 		Insert(user *User) error
+		Get(id int64) (*User, error)
 		GetByEmail(email string) (*User, error)
 		Update(user *User) error
+		Delete(id int64) error
+		GetAll(search string, filters Filters) ([]*User, Metadata, error)
 		GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	}
 	Tokens interface {
 		DeleteAllForUser(scope string, userID int64) error
 		Insert(token *Token) error
 		New(userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewSession(userID int64, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error)
+		Rotate(refreshTokenPlaintext string, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error)
+		Delete(scope, tokenPlaintext string) error
+		Touch(scope, tokenPlaintext string) error
+		GetAllSessionsForUser(userID int64, currentTokenPlaintext string) ([]*Session, error)
+		DeleteOtherSessionsForUser(userID int64, currentTokenPlaintext string) error
+	}
+	APIKeys interface {
+		New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error)
+		GetAllForUser(userID int64) ([]*APIKey, error)
+		GetForKey(keyPlaintext string) (*User, *APIKey, error)
+		Delete(id, userID int64) error
+		DeleteAllForUser(userID int64) error
+	}
+	RecoveryCodes interface {
+		New(userID int64) ([]string, error)
+		Consume(userID int64, code string) (bool, error)
+		DeleteAllForUser(userID int64) error
+	}
+	LoginFailures interface {
+		Insert(email, ipAddress string, since time.Time) (*LoginFailures, error)
+		Delete(email, ipAddress string) error
+		DeleteAllForEmail(email, ipAddress string) error
 	}
 	Permissions interface {
+		GetAll() (Permissions, error)
 		GetAllForUser(userID int64) (Permissions, error)
 		AddForUser(userID int64, codes ...string) error
+		RemoveForUser(userID int64, codes ...string) error
+		GetAllUsersWithPermission(code string) ([]*User, error)
+	}
+	Organizations interface {
+		Insert(org *Organization, ownerID int64) error
+		GetAllForUser(userID int64) ([]*Organization, error)
+		GetMembership(orgID, userID int64) (*Membership, error)
+		AddToDefault(userID int64, role string) error
+		UpdateMember(orgID, userID int64, role string) error
+		NewInvitation(orgID int64, email, role string, ttl time.Duration) (*OrganizationInvitation, error)
+		AcceptInvitation(tokenPlaintext, email string, userID int64) (int64, error)
+		RemoveMember(orgID, userID int64) error
+	}
+	Invitations interface {
+		New(email string, permissions Permissions, expiry time.Time, invitedBy int64) (*Invitation, error)
+		GetAll() ([]*Invitation, error)
+		GetForToken(tokenPlaintext string) (*Invitation, error)
+		DeleteAllForEmail(email string) error
+		Delete(id int64) error
+	}
+	Roles interface {
+		GetAll() ([]*Role, error)
+		GetAllForUser(userID int64) ([]string, error)
+		AddForUser(userID int64, names ...string) error
+		RemoveForUser(userID int64, names ...string) error
 	}
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
 		Movies: MovieModel{DB: db},
+		MovieRevisions: MovieRevisionModel{DB: db},
 		Users: UserModel{DB: db},
 		Tokens: TokenModel{DB:db},
+		APIKeys: APIKeyModel{DB: db},
+		RecoveryCodes: RecoveryCodeModel{DB: db},
+		LoginFailures: LoginFailureModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Roles: RoleModel{DB: db},
+		Organizations: OrganizationModel{DB: db},
+		Invitations: InvitationModel{DB: db},
 	}
 }
 
 func NewMockModels() Models {
 	return Models{
 	Movies: MockMovieModel{},
+	MovieRevisions: MockMovieRevisionModel{},
 	Users: MockUserModel{},
 	Tokens: MockTokenModel{},
+	APIKeys: MockAPIKeyModel{},
+	RecoveryCodes: MockRecoveryCodeModel{},
+	LoginFailures: MockLoginFailureModel{},
 	Permissions: MockPermissionModel{},
+	Roles: MockRoleModel{},
+	Organizations: MockOrganizationModel{},
+	Invitations: MockInvitationModel{},
 	}
 }
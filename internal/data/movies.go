@@ -7,6 +7,10 @@ import "github.com/lib/pq"
 import "errors"
 import "context"
 import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+import "unicode"
 
 type Movie struct {
 	ID        int64     `json:"id"`
@@ -16,6 +20,18 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+	// CreatedBy is the ID of the user who added the movie, or zero for movies
+	// added before ownership was recorded.
+	CreatedBy int64 `json:"created_by,omitempty"`
+	// OrganizationID is the tenant whose catalog the movie belongs to. Every
+	// query below is filtered on it, so movies never cross between tenants.
+	OrganizationID int64 `json:"-"`
+	// DeletedAt is set while the movie is in the trash. Movies in the trash
+	// are left out of everything except the trash listing and restore.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// relevance is the movie's score against the title search in GetAll,
+	// kept for building a cursor when sorting by relevance.
+	relevance float64
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -36,13 +52,21 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
+// Insert() adds a movie and records its first revision, made by the movie's
+// creator.
 func (m MovieModel) Insert(movie *Movie) error {
 	query := `
-INSERT INTO movies (title, year, runtime, genres)
-VALUES ($1, $2, $3, $4)
-RETURNING id, created_at, version`
-
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+WITH inserted AS (
+	INSERT INTO movies (title, year, runtime, genres, created_by, organization_id)
+	VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6)
+	RETURNING id, created_at, version, title, year, runtime, genres, created_by
+), revision AS (
+	INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, created_by, created_at)
+	SELECT id, version, title, year, runtime, genres, created_by, created_at FROM inserted
+)
+SELECT id, created_at, version FROM inserted`
+
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.CreatedBy, movie.OrganizationID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -51,22 +75,31 @@ RETURNING id, created_at, version`
 }
 
 // Add a placeholder method for fetching a specific record from the movies table.
-func (m MovieModel) Get(id int64) (*Movie, error) {
-	if id < 1 {
+func (m MovieModel) Get(orgID, id int64) (*Movie, error) {
+	return m.get(orgID, id, false)
+}
+
+// GetDeleted() fetches a movie that's in the trash.
+func (m MovieModel) GetDeleted(orgID, id int64) (*Movie, error) {
+	return m.get(orgID, id, true)
+}
+
+func (m MovieModel) get(orgID, id int64, deleted bool) (*Movie, error) {
+	if id < 1 || orgID < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, version, coalesce(created_by, 0), organization_id, deleted_at
 		FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND organization_id = $2 AND (deleted_at IS NOT NULL) = $3`
 
 	var movie Movie
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, orgID, deleted).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
@@ -74,6 +107,9 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.CreatedBy,
+		&movie.OrganizationID,
+		&movie.DeletedAt,
 	)
 
 	if err != nil {
@@ -88,13 +124,20 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-// Add a placeholder method for updating a specific record in the movies table.
-func (m MovieModel) Update(movie *Movie) error {
+// Update() saves changes to a movie as a new version, recording a revision
+// made by the given user.
+func (m MovieModel) Update(movie *Movie, userID int64) error {
 	query := `
-UPDATE movies
-SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-WHERE id = $5 AND version = $6
-RETURNING version`
+WITH updated AS (
+	UPDATE movies
+	SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+	WHERE id = $5 AND version = $6 AND organization_id = $7 AND deleted_at IS NULL
+	RETURNING id, version, title, year, runtime, genres
+), revision AS (
+	INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, created_by)
+	SELECT id, version, title, year, runtime, genres, NULLIF($8, 0) FROM updated
+)
+SELECT version FROM updated`
 
 	args := []any{
 		movie.Title,
@@ -103,6 +146,8 @@ RETURNING version`
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
+		movie.OrganizationID,
+		userID,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -121,20 +166,29 @@ RETURNING version`
 	return nil
 }
 
-// Add a placeholder method for deleting a specific record from the movies table.
-func (m MovieModel) Delete(id int64) error {
-	if id < 1 {
+// Delete() moves a movie to the trash. It stays there, restorable, until
+// PurgeDeleted() removes it for good. Like any other change the version is
+// bumped, but no revision is recorded since the movie's details are the same,
+// so the history skips the versions used by trashing and restoring.
+//
+// A non-zero version makes the delete conditional: it only goes ahead if the
+// movie is still at that version, and ErrEditConflict is returned otherwise,
+// as Update() does.
+func (m MovieModel) Delete(orgID, id int64, version int32) error {
+	if id < 1 || orgID < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-	DELETE FROM movies
-	WHERE id = $1`
+	UPDATE movies
+	SET deleted_at = NOW(), version = version + 1
+	WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL
+	AND ($3 = 0 OR version = $3)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, orgID, version)
 	if err != nil {
 		return err
 	}
@@ -145,42 +199,67 @@ func (m MovieModel) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
+		if version != 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// Restore() takes a movie fetched with GetDeleted() back out of the trash,
+// bumping its version as Delete() does.
+func (m MovieModel) Restore(movie *Movie) error {
+	query := `
+	UPDATE movies
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND version = $2 AND organization_id = $3 AND deleted_at IS NOT NULL
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, movie.Version, movie.OrganizationID).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	movie.DeletedAt = nil
+	return nil
+}
+
+// GetAllDeleted() returns a page of the organization's trash.
+func (m MovieModel) GetAllDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, coalesce(created_by, 0), organization_id, deleted_at
 	FROM movies
-	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-	AND (genres @> $2 OR $2 = '{}')
+	WHERE organization_id = $1 AND deleted_at IS NOT NULL
 	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
-	
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, orgID, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
-	movies := []*Movie{}
-
-	
 	totalRecords := 0
+	movies := []*Movie{}
 
 	for rows.Next() {
 		var movie Movie
 
 		err := rows.Scan(
-			&totalRecords, 
+			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
@@ -188,6 +267,9 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.CreatedBy,
+			&movie.OrganizationID,
+			&movie.DeletedAt,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -205,13 +287,513 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// PurgeDeleted() permanently removes movies, across every organization, that
+// were moved to the trash before the given time. It returns how many were
+// removed.
+func (m MovieModel) PurgeDeleted(before time.Time) (int64, error) {
+	query := `
+	DELETE FROM movies
+	WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// MovieFilters narrows the movies returned by MovieModel.GetAll. A zero value
+// leaves the corresponding filter unset.
+type MovieFilters struct {
+	// Title is matched as a full-text search.
+	Title string
+	// Genres must all be present on a movie.
+	Genres []string
+	// GenresAny requires at least one of its genres to be present.
+	GenresAny []string
+	// GenresExclude rejects movies with any of its genres.
+	GenresExclude []string
+	YearMin       int32
+	YearMax       int32
+	RuntimeMin    int32
+	RuntimeMax    int32
+	// CreatedAfter, if set, only includes movies added after this time.
+	CreatedAfter *time.Time
+}
+
+func ValidateMovieFilters(v *validator.Validator, mf MovieFilters) {
+	maxYear := int32(time.Now().Year())
+
+	for _, year := range []struct {
+		key   string
+		value int32
+	}{{"year_min", mf.YearMin}, {"year_max", mf.YearMax}} {
+		if year.value != 0 {
+			v.Check(year.value >= 1888, year.key, "must be greater than 1888")
+			v.Check(year.value <= maxYear, year.key, "must not be in the future")
+		}
+	}
+	if mf.YearMin != 0 && mf.YearMax != 0 {
+		v.Check(mf.YearMin <= mf.YearMax, "year_max", "must not be less than year_min")
+	}
+
+	v.Check(mf.RuntimeMin >= 0, "runtime_min", "must be a positive integer")
+	v.Check(mf.RuntimeMax >= 0, "runtime_max", "must be a positive integer")
+	if mf.RuntimeMin != 0 && mf.RuntimeMax != 0 {
+		v.Check(mf.RuntimeMin <= mf.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	}
+
+	v.Check(validator.Unique(mf.GenresAny), "genres_any", "must not contain duplicate values")
+	v.Check(validator.Unique(mf.GenresExclude), "genres_exclude", "must not contain duplicate values")
+	for _, genre := range mf.GenresExclude {
+		v.Check(!validator.PermittedValue(genre, mf.Genres...), "genres_exclude", "must not contain a genre that is also required")
+		v.Check(!validator.PermittedValue(genre, mf.GenresAny...), "genres_exclude", "must not contain a genre that is also in genres_any")
+	}
+
+	if mf.CreatedAfter != nil {
+		v.Check(!mf.CreatedAfter.After(time.Now()), "created_after", "must not be in the future")
+	}
+}
+
+// movieFilters is the WHERE clause shared by the movie listing and its count.
+// Its placeholders are bound to the values from MovieFilters.args(). Each
+// condition is skipped when its value is unset. Movies in the trash are
+// always left out.
+const movieFilters = `
+	WHERE organization_id = $1
+	AND deleted_at IS NULL
+	AND ($2 = '' OR to_tsvector('simple', title) @@ to_tsquery('simple', $11) OR $2 <% title)
+	AND (genres @> $3 OR $3 = '{}')
+	AND (genres && $4 OR $4 = '{}')
+	AND (NOT (genres && $5) OR $5 = '{}')
+	AND (year >= $6 OR $6 = 0)
+	AND (year <= $7 OR $7 = 0)
+	AND (runtime >= $8 OR $8 = 0)
+	AND (runtime <= $9 OR $9 = 0)
+	AND (created_at > $10 OR $10 IS NULL)`
+
+// movieFiltersArgs is the number of placeholders used by movieFilters.
+const movieFiltersArgs = 11
+
+// movieRelevance scores how well a movie's title matches the title search,
+// combining the full-text rank of the prefix query with trigram word
+// similarity so that misspelt searches still rank their closest matches first.
+const movieRelevance = `(CASE WHEN $2 = '' THEN 0
+	ELSE ts_rank(to_tsvector('simple', title), to_tsquery('simple', $11)) + word_similarity($2, title)
+	END)::float8`
+
+// CacheKey() returns a string that is the same for any two filters selecting
+// the same movies, however the query string that produced them was written.
+func (mf MovieFilters) CacheKey() string {
+	sorted := func(genres []string) []string {
+		genres = append([]string(nil), genres...)
+		sort.Strings(genres)
+		return genres
+	}
+
+	var createdAfter string
+	if mf.CreatedAfter != nil {
+		createdAfter = mf.CreatedAfter.UTC().Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprintf("%q|%q|%q|%q|%d-%d|%d-%d|%s",
+		mf.Title,
+		sorted(mf.Genres),
+		sorted(mf.GenresAny),
+		sorted(mf.GenresExclude),
+		mf.YearMin, mf.YearMax,
+		mf.RuntimeMin, mf.RuntimeMax,
+		createdAfter,
+	)
+}
+
+func (mf MovieFilters) args(orgID int64) []any {
+	var createdAfter any
+	if mf.CreatedAfter != nil {
+		createdAfter = *mf.CreatedAfter
+	}
+
+	return []any{
+		orgID,
+		mf.Title,
+		pq.Array(nonNil(mf.Genres)),
+		pq.Array(nonNil(mf.GenresAny)),
+		pq.Array(nonNil(mf.GenresExclude)),
+		mf.YearMin,
+		mf.YearMax,
+		mf.RuntimeMin,
+		mf.RuntimeMax,
+		createdAfter,
+		prefixTSQuery(mf.Title),
+	}
+}
+
+// prefixTSQuery() turns a title search into a tsquery matching titles that
+// contain every word, with the last letters of each word optional, so "godf"
+// matches "The Godfather". Only letters and digits are kept, which leaves no
+// tsquery syntax for the input to inject.
+func prefixTSQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// nonNil() turns a nil slice into an empty one, which pq sends as '{}' rather
+// than NULL so the "unset" comparisons in movieFilters hold.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// GetAll() returns a page of movies, either at the filters' page number or,
+// when filters.Cursor is set, after the cursor's position. Metadata.NextCursor
+// is set whenever there's another page.
+func (m MovieModel) GetAll(orgID int64, mf MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	args := append(mf.args(orgID), filters.limit()+1, filters.offset())
+
+	keyset := ""
+	if filters.Cursor != "" {
+		c, err := filters.cursor()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		keyset = "WHERE " + filters.keysetCondition(movieFiltersArgs+3, movieFiltersArgs+4)
+		args = append(args, c.Value, c.ID)
+	}
+
+	// One row more than the page size is fetched, to find out whether there
+	// is a next page without counting. The subquery names the relevance score
+	// so the keyset condition and ORDER BY can refer to it like a column.
+	query := fmt.Sprintf(`
+	SELECT id, created_at, title, year, runtime, genres, version, coalesce(created_by, 0), organization_id, relevance
+	FROM (SELECT *, %s AS relevance FROM movies %s) AS movies
+	%s
+	ORDER BY %s %s, id ASC
+	LIMIT $%d OFFSET $%d`, movieRelevance, movieFilters, keyset, filters.sortColumn(), filters.sortDirection(), movieFiltersArgs+1, movieFiltersArgs+2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.CreatedBy,
+			&movie.OrganizationID,
+			&movie.relevance,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	nextCursor := ""
+	if len(movies) > filters.limit() {
+		movies = movies[:filters.limit()]
+		last := movies[len(movies)-1]
+		nextCursor = encodeCursor(cursor{Sort: filters.Sort, Value: last.sortValue(filters.sortColumn()), ID: last.ID})
+	}
+
+	totalRecords := 0
+	if filters.IncludeTotal {
+		err = m.DB.QueryRowContext(ctx, "SELECT count(*) FROM movies"+movieFilters, mf.args(orgID)...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	var metadata Metadata
+	switch {
+	case filters.Cursor != "":
+		metadata = Metadata{PageSize: filters.PageSize, TotalRecords: totalRecords}
+	case filters.IncludeTotal:
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	default:
+		metadata = Metadata{CurrentPage: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	}
+	metadata.NextCursor = nextCursor
+
+	return movies, metadata, nil
+}
+
+// sortValue() returns the movie's value for a sort column, in the text form
+// stored in a cursor.
+func (movie *Movie) sortValue(column string) string {
+	switch column {
+	case "relevance":
+		return strconv.FormatFloat(movie.relevance, 'g', -1, 64)
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(movie.Runtime), 10)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// Suggest() returns up to limit distinct titles for autocompleting a search,
+// best match first. Titles match on a word prefix or, to allow for typos, on
+// trigram word similarity.
+func (m MovieModel) Suggest(orgID int64, prefix string, limit int) ([]string, error) {
+	query := `
+	SELECT title
+	FROM movies
+	WHERE organization_id = $1 AND deleted_at IS NULL
+	AND (to_tsvector('simple', title) @@ to_tsquery('simple', $2) OR $3 <% title)
+	GROUP BY title
+	ORDER BY word_similarity($3, title) DESC, title ASC
+	LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID, prefixTSQuery(prefix), prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []string{}
+
+	for rows.Next() {
+		var title string
+
+		err := rows.Scan(&title)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// FacetNames are the facets GetFacets() can count.
+var FacetNames = []string{"genres", "year"}
+
+// FacetCount is the number of movies sharing one value of a facet.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds the counts for each requested facet, keyed by facet name.
+type Facets map[string][]FacetCount
+
+func ValidateFacets(v *validator.Validator, names []string) {
+	v.Check(validator.Unique(names), "facets", "must not contain duplicate values")
+	for _, name := range names {
+		v.Check(validator.PermittedValue(name, FacetNames...), "facets", fmt.Sprintf("%q is not a known facet", name))
+	}
+}
+
+// facetQueries holds the query counting each facet. They're run with the same
+// filters as GetAll, except that a facet's own filters are cleared first (see
+// GetFacets), so a client can see the alternatives to what it has selected.
+var facetQueries = map[string]string{
+	"genres": `
+	SELECT genre, count(*)
+	FROM movies CROSS JOIN unnest(genres) AS genre` + movieFilters + `
+	GROUP BY genre
+	ORDER BY count(*) DESC, genre ASC`,
+	"year": `
+	SELECT (year / 10 * 10)::text || 's', count(*)
+	FROM movies` + movieFilters + `
+	GROUP BY year / 10
+	ORDER BY year / 10 ASC`,
+}
+
+// GetFacets() returns counts of the movies matching mf for each named facet:
+// movies per genre, and movies per decade for "year".
+func (m MovieModel) GetFacets(orgID int64, mf MovieFilters, names []string) (Facets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	facets := Facets{}
+
+	for _, name := range names {
+		query, ok := facetQueries[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown facet %q", name)
+		}
+
+		facetFilters := mf
+		switch name {
+		case "genres":
+			facetFilters.Genres = nil
+			facetFilters.GenresAny = nil
+			facetFilters.GenresExclude = nil
+		case "year":
+			facetFilters.YearMin = 0
+			facetFilters.YearMax = 0
+		}
+
+		counts, err := m.countFacet(ctx, query, facetFilters.args(orgID))
+		if err != nil {
+			return nil, err
+		}
+
+		facets[name] = counts
+	}
+
+	return facets, nil
+}
+
+func (m MovieModel) countFacet(ctx context.Context, query string, args []any) ([]FacetCount, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []FacetCount{}
+
+	for rows.Next() {
+		var count FacetCount
+
+		err := rows.Scan(&count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// MovieStats holds aggregates over the movies matching a set of filters.
+// Runtimes are in minutes.
+type MovieStats struct {
+	TotalMovies    int          `json:"total_movies"`
+	AverageRuntime float64      `json:"average_runtime"`
+	MedianRuntime  float64      `json:"median_runtime"`
+	Genres         []FacetCount `json:"genres"`
+	Decades        []FacetCount `json:"decades"`
+	Years          []YearCount  `json:"years"`
+}
+
+// YearCount is one bar of the year histogram in MovieStats.
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int   `json:"count"`
+}
+
+// GetStats() computes MovieStats over the movies matching mf. The genre and
+// decade counts use the same queries as the list facets, but here every
+// filter applies to them.
+func (m MovieModel) GetStats(orgID int64, mf MovieFilters) (*MovieStats, error) {
+	query := `
+	SELECT count(*),
+		coalesce(round(avg(runtime), 1), 0),
+		coalesce(percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime), 0)
+	FROM movies` + movieFilters
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := mf.args(orgID)
+
+	var stats MovieStats
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&stats.TotalMovies, &stats.AverageRuntime, &stats.MedianRuntime)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Genres, err = m.countFacet(ctx, facetQueries["genres"], args)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Decades, err = m.countFacet(ctx, facetQueries["year"], args)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT year, count(*)
+	FROM movies` + movieFilters + `
+	GROUP BY year
+	ORDER BY year ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.Years = []YearCount{}
+
+	for rows.Next() {
+		var year YearCount
+
+		err := rows.Scan(&year.Year, &year.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Years = append(stats.Years, year)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
 type MockMovieModel struct{}
 
 func (m MockMovieModel) Insert(movie *Movie) error {
 	return nil
 }
 
-func (m MockMovieModel) Get(id int64) (*Movie, error) {
+func (m MockMovieModel) Get(orgID, id int64) (*Movie, error) {
 	switch id {
 	case 1:
 		return &Movie{
@@ -221,24 +803,113 @@ func (m MockMovieModel) Get(id int64) (*Movie, error) {
 			Runtime: 105,
 			Title: "Test Mock",
 			Genres: []string{""},
+			Version: 2,
+			CreatedBy: 1,
+		}, nil
+	case 3:
+		return &Movie{
+			ID: 3,
+			CreatedAt: time.Now(),
+			Year: 2023,
+			Runtime: 105,
+			Title: "Test Mock",
+			Genres: []string{""},
+			Version: 1,
+			CreatedBy: 3,
 		}, nil
 	default:
 		return nil, ErrRecordNotFound
 	}
 }
-func (m MockMovieModel) Update(movie *Movie) error {
+func (m MockMovieModel) Update(movie *Movie, userID int64) error {
 	return nil
 }
 
-func (m MockMovieModel) Delete(id int64) error {
-	switch id {
-	case 1:
+// In the mock, movie 3 always changes between being fetched and a conditional
+// delete of it.
+func (m MockMovieModel) Delete(orgID, id int64, version int32) error {
+	switch {
+	case id == 1 && (version == 0 || version == 2):
 		return nil
+	case id == 1 || (id == 3 && version != 0):
+		return ErrEditConflict
 	default:
 		return ErrRecordNotFound
 	}
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) { 
+// The mock's trash holds movie 5, owned by user 1.
+func mockDeletedMovie() *Movie {
+	deletedAt := time.Now().Add(-time.Hour)
+	return &Movie{
+		ID:        5,
+		CreatedAt: time.Now().Add(-24 * time.Hour),
+		Year:      2020,
+		Runtime:   95,
+		Title:     "Deleted Mock",
+		Genres:    []string{"drama"},
+		CreatedBy: 1,
+		DeletedAt: &deletedAt,
+	}
+}
+
+func (m MockMovieModel) GetDeleted(orgID, id int64) (*Movie, error) {
+	if id == 5 {
+		return mockDeletedMovie(), nil
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMovieModel) Restore(movie *Movie) error {
+	movie.DeletedAt = nil
+	movie.Version++
+	return nil
+}
+
+func (m MockMovieModel) GetAllDeleted(orgID int64, filters Filters) ([]*Movie, Metadata, error) {
+	return []*Movie{mockDeletedMovie()}, calculateMetadata(1, filters.Page, filters.PageSize), nil
+}
+
+func (m MockMovieModel) PurgeDeleted(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m MockMovieModel) GetAll(orgID int64, mf MovieFilters, filters Filters) ([]*Movie, Metadata, error) { 
 	return nil, Metadata{}, nil
 }
+
+func (m MockMovieModel) GetFacets(orgID int64, mf MovieFilters, names []string) (Facets, error) {
+	facets := Facets{}
+	for _, name := range names {
+		switch name {
+		case "genres":
+			facets[name] = []FacetCount{{Value: "drama", Count: 2}, {Value: "comedy", Count: 1}}
+		case "year":
+			facets[name] = []FacetCount{{Value: "2020s", Count: 2}}
+		}
+	}
+	return facets, nil
+}
+
+func (m MockMovieModel) GetStats(orgID int64, mf MovieFilters) (*MovieStats, error) {
+	return &MovieStats{
+		TotalMovies:    2,
+		AverageRuntime: 112.5,
+		MedianRuntime:  112.5,
+		Genres:         []FacetCount{{Value: "drama", Count: 2}},
+		Decades:        []FacetCount{{Value: "2020s", Count: 2}},
+		Years:          []YearCount{{Year: 2021, Count: 1}, {Year: 2023, Count: 1}},
+	}, nil
+}
+
+func (m MockMovieModel) Suggest(orgID int64, prefix string, limit int) ([]string, error) {
+	deletedAt := time.Now()
+
+	titles := []string{}
+	for _, movie := range []*Movie{{Title: "Test Mock"}, {Title: "Deleted Mock", DeletedAt: &deletedAt}} {
+		if movie.DeletedAt == nil && strings.HasPrefix(strings.ToLower(movie.Title), strings.ToLower(prefix)) {
+			titles = append(titles, movie.Title)
+		}
+	}
+	return titles, nil
+}
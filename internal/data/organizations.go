@@ -0,0 +1,409 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.bcc/internal/validator"
+)
+
+var ErrAlreadyMember = errors.New("already a member")
+
+// Organization is a tenant with its own movie catalog. Users take part through
+// a membership, which gives them one of the roles within that organization.
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// Membership is a user's place in an organization. Permissions holds the codes
+// granted by the membership role, which are added to the user's own codes
+// within the organization. Only movie codes are taken from the role, since the
+// catalog is the only thing an organization owns; a role's users:admin code,
+// for example, is not granted.
+type Membership struct {
+	OrganizationID int64       `json:"organization_id"`
+	UserID         int64       `json:"user_id"`
+	Role           string      `json:"role"`
+	Permissions    Permissions `json:"permissions"`
+}
+
+// OrganizationInvitation asks an existing user to join an organization with
+// the given role. Nobody is added to an organization without accepting one. As
+// with tokens, only a hash of the code is stored.
+type OrganizationInvitation struct {
+	ID               int64     `json:"id"`
+	OrganizationID   int64     `json:"organization_id"`
+	OrganizationName string    `json:"-"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	Plaintext        string    `json:"-"`
+	Hash             []byte    `json:"-"`
+	Expiry           time.Time `json:"expiry"`
+}
+
+func generateOrganizationInvitation(orgID int64, email, role string, ttl time.Duration) (*OrganizationInvitation, error) {
+	invitation := &OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		Expiry:         time.Now().Add(ttl),
+	}
+
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(invitation.Plaintext))
+	invitation.Hash = hash[:]
+
+	return invitation, nil
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+// Insert() creates an organization with the given user as its first admin.
+func (m OrganizationModel) Insert(org *Organization, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO organizations (name)
+	VALUES ($1)
+	RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query, org.Name).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO organization_members
+	SELECT $1, $2, roles.id FROM roles WHERE roles.name = 'admin'`
+
+	_, err = tx.ExecContext(ctx, query, org.ID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	org.Role = "admin"
+
+	return tx.Commit()
+}
+
+func (m OrganizationModel) GetAllForUser(userID int64) ([]*Organization, error) {
+	query := `
+	SELECT organizations.id, organizations.created_at, organizations.name, roles.name
+	FROM organizations
+	INNER JOIN organization_members ON organization_members.organization_id = organizations.id
+	INNER JOIN roles ON organization_members.role_id = roles.id
+	WHERE organization_members.user_id = $1
+	ORDER BY organizations.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		var org Organization
+		err := rows.Scan(&org.ID, &org.CreatedAt, &org.Name, &org.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &org)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (m OrganizationModel) GetMembership(orgID, userID int64) (*Membership, error) {
+	query := `
+	SELECT organization_members.organization_id, organization_members.user_id, roles.name,
+	coalesce(array_agg(permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM organization_members
+	INNER JOIN roles ON organization_members.role_id = roles.id
+	LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id AND permissions.code LIKE 'movies:%'
+	WHERE organization_members.organization_id = $1 AND organization_members.user_id = $2
+	GROUP BY organization_members.organization_id, organization_members.user_id, roles.name`
+
+	var membership Membership
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, orgID, userID).Scan(
+		&membership.OrganizationID,
+		&membership.UserID,
+		&membership.Role,
+		pq.Array(&membership.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &membership, nil
+}
+
+// AddToDefault() adds a new user to the default organization, which holds the
+// catalog every account could read before organizations existed.
+func (m OrganizationModel) AddToDefault(userID int64, role string) error {
+	query := `
+	INSERT INTO organization_members
+	SELECT organizations.id, $1, roles.id
+	FROM organizations, roles
+	WHERE organizations.name = 'Default' AND roles.name = $2
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, role)
+	return err
+}
+
+// UpdateMember() changes the role of an existing member. Users join through
+// an invitation, so ErrRecordNotFound is returned for anyone else.
+func (m OrganizationModel) UpdateMember(orgID, userID int64, role string) error {
+	query := `
+	UPDATE organization_members
+	SET role_id = roles.id
+	FROM roles
+	WHERE roles.name = $3
+	AND organization_members.organization_id = $1 AND organization_members.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// NewInvitation() creates an invitation for the email address to join the
+// organization with the given role.
+func (m OrganizationModel) NewInvitation(orgID int64, email, role string, ttl time.Duration) (*OrganizationInvitation, error) {
+	invitation, err := generateOrganizationInvitation(orgID, email, role, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO organization_invitations (organization_id, email, hash, role_id, expiry)
+	SELECT $1, $2, $3, roles.id, $5 FROM roles WHERE roles.name = $4
+	RETURNING id, (SELECT name FROM organizations WHERE id = $1)`
+
+	args := []any{invitation.OrganizationID, invitation.Email, invitation.Hash, invitation.Role, invitation.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.OrganizationName)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation() adds the user to the organization named in an unexpired
+// invitation sent to their email address, and returns the organization's ID.
+// The invitation is used up in the same statement, so it can't be accepted
+// twice. If the user is already a member, ErrAlreadyMember is returned and their
+// role is left alone, so an old invitation can't change it.
+func (m OrganizationModel) AcceptInvitation(tokenPlaintext, email string, userID int64) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	WITH invitation AS (
+		DELETE FROM organization_invitations
+		WHERE hash = $1 AND email = $2 AND expiry > NOW()
+		RETURNING organization_id, role_id
+	), member AS (
+		INSERT INTO organization_members
+		SELECT organization_id, $3, role_id FROM invitation
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+		RETURNING organization_id
+	)
+	SELECT invitation.organization_id, member.organization_id IS NOT NULL
+	FROM invitation
+	LEFT JOIN member ON member.organization_id = invitation.organization_id`
+
+	var (
+		orgID int64
+		added bool
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], email, userID).Scan(&orgID, &added)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	if !added {
+		return 0, ErrAlreadyMember
+	}
+
+	return orgID, nil
+}
+
+func (m OrganizationModel) RemoveMember(orgID, userID int64) error {
+	query := `
+	DELETE FROM organization_members
+	WHERE organization_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type MockOrganizationModel struct{}
+
+func (m MockOrganizationModel) Insert(org *Organization, ownerID int64) error {
+	org.ID = 2
+	org.CreatedAt = time.Now()
+	org.Role = "admin"
+	return nil
+}
+
+func (m MockOrganizationModel) GetAllForUser(userID int64) ([]*Organization, error) {
+	switch userID {
+	case 1, 4:
+		return []*Organization{{ID: 1, CreatedAt: time.Now(), Name: "Default"}}, nil
+	default:
+		return []*Organization{}, nil
+	}
+}
+
+func (m MockOrganizationModel) GetMembership(orgID, userID int64) (*Membership, error) {
+	if orgID != 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	switch userID {
+	case 1:
+		return &Membership{OrganizationID: 1, UserID: 1, Role: "viewer", Permissions: Permissions{"movies:read"}}, nil
+	case 2:
+		return &Membership{OrganizationID: 1, UserID: 2, Role: "editor", Permissions: Permissions{"movies:read", "movies:write"}}, nil
+	case 4:
+		return &Membership{OrganizationID: 1, UserID: 4, Role: "admin", Permissions: Permissions{"movies:*"}}, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
+
+func (m MockOrganizationModel) AddToDefault(userID int64, role string) error {
+	return nil
+}
+
+func (m MockOrganizationModel) UpdateMember(orgID, userID int64, role string) error {
+	_, err := m.GetMembership(orgID, userID)
+	return err
+}
+
+func (m MockOrganizationModel) NewInvitation(orgID int64, email, role string, ttl time.Duration) (*OrganizationInvitation, error) {
+	invitation, err := generateOrganizationInvitation(orgID, email, role, ttl)
+	if err != nil {
+		return nil, err
+	}
+	invitation.ID = 1
+	invitation.OrganizationName = "Default"
+	return invitation, nil
+}
+
+func (m MockOrganizationModel) AcceptInvitation(tokenPlaintext, email string, userID int64) (int64, error) {
+	if email != "example@gmail.com" || userID != 1 {
+		return 0, ErrRecordNotFound
+	}
+
+	switch tokenPlaintext {
+	case "oooooooooooooooooooooooooo":
+		return 1, nil
+	case "qqqqqqqqqqqqqqqqqqqqqqqqqq":
+		return 0, ErrAlreadyMember
+	default:
+		return 0, ErrRecordNotFound
+	}
+}
+
+func (m MockOrganizationModel) RemoveMember(orgID, userID int64) error {
+	switch userID {
+	case 1:
+		return nil
+	default:
+		return ErrRecordNotFound
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"bufio"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// common_passwords.txt holds one lowercase password per line. It's kept
+// readable so entries can be reviewed and added to; at startup each entry is
+// reduced to the first 8 bytes of its SHA-256 hash and the hashes are sorted,
+// so a lookup is a binary search over a slice of uint64s.
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = loadPasswordBlocklist(commonPasswordsFile)
+
+type passwordBlocklist []uint64
+
+func loadPasswordBlocklist(list string) passwordBlocklist {
+	var bl passwordBlocklist
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		bl = append(bl, passwordPrefix(line))
+	}
+
+	sort.Slice(bl, func(i, j int) bool { return bl[i] < bl[j] })
+	return bl
+}
+
+// passwordPrefix() returns the first 8 bytes of the SHA-256 hash of the
+// lowercased password. With a list this size a false positive is vanishingly
+// unlikely, and the only cost of one is asking the user for another password.
+func passwordPrefix(password string) uint64 {
+	sum := sha256.Sum256([]byte(strings.ToLower(password)))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Contains() reports whether the password, ignoring case, is on the list.
+func (bl passwordBlocklist) Contains(password string) bool {
+	prefix := passwordPrefix(password)
+	i := sort.Search(len(bl), func(i int) bool { return bl[i] >= prefix })
+	return i < len(bl) && bl[i] == prefix
+}
+
+// minSimilarityLength is the shortest part of a name or email address that's
+// compared against the password. Shorter parts, like initials, would reject
+// too many unrelated passwords.
+const minSimilarityLength = 4
+
+// passwordSimilarTo() reports whether the password is built from the user's
+// email address or name: it contains one of them (or a word of the name or of
+// the address's local part), is contained in one, or is within a couple of
+// edits of one.
+func passwordSimilarTo(password string, values ...string) bool {
+	password = strings.ToLower(password)
+
+	var parts []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		parts = append(parts, value)
+
+		// Only the local part of an email address is personal; the domain
+		// is shared with everyone else on the same provider.
+		if local, _, found := strings.Cut(value, "@"); found {
+			value = local
+			parts = append(parts, value)
+		}
+		words := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		parts = append(parts, words...)
+		parts = append(parts, strings.Join(words, ""))
+	}
+
+	for _, part := range parts {
+		if len(part) < minSimilarityLength {
+			continue
+		}
+		if strings.Contains(password, part) || strings.Contains(part, password) {
+			return true
+		}
+		if levenshtein(password, part) <= 2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// levenshtein() returns the number of single-rune insertions, deletions and
+// substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
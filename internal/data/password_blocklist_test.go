@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+
+	"greenlight.bcc/internal/validator"
+)
+
+func TestPasswordBlocklist(t *testing.T) {
+	for _, tt := range []struct {
+		plaintext string
+		want      bool
+	}{
+		{"password123", true},
+		{"PASSWORD123", true},
+		{"qwertyuiop", true},
+		{"pa55word", true},
+		{"QWERTY549", false},
+		{"correct horse battery staple", false},
+	} {
+		if got := commonPasswords.Contains(tt.plaintext); got != tt.want {
+			t.Errorf("Contains(%q) = %v; want %v", tt.plaintext, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordSimilarTo(t *testing.T) {
+	const (
+		email = "bakhtiyar.amanzhol@gmail.com"
+		name  = "Amanzhol Bakhtiyar"
+	)
+
+	for _, tt := range []struct {
+		plaintext string
+		want      bool
+	}{
+		{"Amanzhol2024", true},
+		{"bakhtiyar!", true},
+		{"bakhtiyar.amanzhol", true},
+		{"amanzhok", true},
+		{"bakhtiyaramanzhol", true},
+		{"gmail.com1", false},
+		{"QWERTY549", false},
+	} {
+		if got := passwordSimilarTo(tt.plaintext, email, name); got != tt.want {
+			t.Errorf("passwordSimilarTo(%q) = %v; want %v", tt.plaintext, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePasswordStrength(t *testing.T) {
+	v := validator.New()
+	ValidatePasswordStrength(v, "QWERTY549", "example@gmail.com", "Amanzhol Bakhtiyar")
+	if !v.Valid() {
+		t.Errorf("unexpected errors %v", v.Errors)
+	}
+
+	v = validator.New()
+	ValidatePasswordStrength(v, "iloveyou123", "example@gmail.com", "Amanzhol Bakhtiyar")
+	if v.Errors["password"] == "" {
+		t.Error("expected a common password to be rejected")
+	}
+
+	v = validator.New()
+	ValidatePasswordStrength(v, "example2024", "example@gmail.com", "Amanzhol Bakhtiyar")
+	if v.Errors["password"] == "" {
+		t.Error("expected a password built from the email address to be rejected")
+	}
+}
@@ -0,0 +1,169 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are stored in a self-describing format, so the algorithm and cost
+// used for each hash can be read back from the hash itself. New hashes use
+// argon2id in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+//
+// Hashes created before argon2id was introduced are bcrypt hashes ("$2a$..."),
+// which are still verified and are replaced after the next successful login.
+
+// maxPasswordLength bounds the work done hashing a password. It isn't an
+// algorithm limit; argon2id uses every byte of the password.
+const maxPasswordLength = 1024
+
+// bcryptMaxLength is the number of bytes bcrypt actually uses. Passwords for
+// legacy bcrypt hashes were never allowed to be longer than this.
+const bcryptMaxLength = 72
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+// currentArgon2idParams are used for new hashes. Changing them causes existing
+// hashes to be upgraded as their owners log in.
+var currentArgon2idParams = argon2idParams{
+	memory:      64 * 1024,
+	iterations:  1,
+	parallelism: 4,
+	saltLength:  16,
+	keyLength:   32,
+}
+
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+func (p *password) Set(plaintextPassword string) error {
+	hash, err := hashArgon2id(plaintextPassword, currentArgon2idParams)
+	if err != nil {
+		return err
+	}
+	p.plaintext = &plaintextPassword
+	p.hash = hash
+	return nil
+}
+
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if isBcryptHash(p.hash) {
+		// bcrypt would ignore everything past the 72nd byte, so a longer
+		// password must not be allowed to match on its prefix.
+		if len(plaintextPassword) > bcryptMaxLength {
+			return false, nil
+		}
+
+		err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+		if err != nil {
+			switch {
+			case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(p.hash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(plaintextPassword), salt, params.iterations, params.memory, params.parallelism, params.keyLength)
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// NeedsRehash() reports whether the hash was made with an older algorithm or
+// different parameters than new hashes are, and so should be replaced.
+func (p *password) NeedsRehash() bool {
+	if isBcryptHash(p.hash) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2id(p.hash)
+	if err != nil {
+		return true
+	}
+
+	return params != currentArgon2idParams
+}
+
+func isBcryptHash(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$2a$") || strings.HasPrefix(string(hash), "$2b$") || strings.HasPrefix(string(hash), "$2y$")
+}
+
+func hashArgon2id(plaintextPassword string, params argon2idParams) ([]byte, error) {
+	salt := make([]byte, params.saltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), salt, params.iterations, params.memory, params.parallelism, params.keyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.memory,
+		params.iterations,
+		params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+func decodeArgon2id(hash []byte) (argon2idParams, []byte, []byte, error) {
+	var params argon2idParams
+
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.saltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.keyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+// legacyBcryptHash is a bcrypt hash of "pa55word" at the minimum cost.
+const legacyBcryptHash = "$2a$04$XfEVqHsm8qolsl.JOgbLVuFxShQLEauKKIrgJBROyx1AaBkV/0dCq"
+
+func TestPasswordArgon2id(t *testing.T) {
+	var p password
+
+	err := p.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(p.hash), "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Errorf("unexpected hash format %q", p.hash)
+	}
+
+	for _, tt := range []struct {
+		plaintext string
+		want      bool
+	}{
+		{"pa55word", true},
+		{"pa55wordx", false},
+		{"", false},
+	} {
+		match, err := p.Matches(tt.plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != tt.want {
+			t.Errorf("Matches(%q) = %v; want %v", tt.plaintext, match, tt.want)
+		}
+	}
+
+	if p.NeedsRehash() {
+		t.Error("a hash made with the current parameters should not need rehashing")
+	}
+}
+
+func TestPasswordLegacyBcrypt(t *testing.T) {
+	p := password{hash: []byte(legacyBcryptHash)}
+
+	match, err := p.Matches("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("bcrypt hash should still verify")
+	}
+
+	// bcrypt only looks at the first 72 bytes, so without the length check this
+	// would match any password sharing that prefix.
+	match, err = p.Matches("pa55word" + strings.Repeat("x", 80))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("password longer than 72 bytes should not match a bcrypt hash")
+	}
+
+	if !p.NeedsRehash() {
+		t.Error("bcrypt hash should need rehashing")
+	}
+}
+
+func TestPasswordNeedsRehashAfterParamsChange(t *testing.T) {
+	old := currentArgon2idParams
+	defer func() { currentArgon2idParams = old }()
+
+	var p password
+	err := p.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentArgon2idParams.iterations++
+
+	if !p.NeedsRehash() {
+		t.Error("hash made with older parameters should need rehashing")
+	}
+
+	match, err := p.Matches("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("hash made with older parameters should still verify")
+	}
+}
+
+func TestPasswordInvalidHash(t *testing.T) {
+	p := password{hash: []byte("$argon2id$v=19$m=abc$salt$key")}
+
+	_, err := p.Matches("pa55word")
+	if err != ErrInvalidHash {
+		t.Errorf("got %v; want %v", err, ErrInvalidHash)
+	}
+}
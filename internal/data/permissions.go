@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -10,9 +11,14 @@ import (
 
 type Permissions []string
 
+// Include() reports whether the permissions grant the given code. A held code
+// of "movies:*" grants every "movies:" code, and "*" on its own grants all.
 func (p Permissions) Include(code string) bool {
 	for i := range p {
-		if code == p[i] {
+		if code == p[i] || p[i] == "*" {
+			return true
+		}
+		if strings.HasSuffix(p[i], ":*") && strings.HasPrefix(code, strings.TrimSuffix(p[i], "*")) {
 			return true
 		}
 	}
@@ -23,13 +29,52 @@ type PermissionModel struct {
 	DB *sql.DB
 }
 
+// GetAll() lists every permission code that can be granted.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+	SELECT code
+	FROM permissions
+	ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	// Codes granted directly and codes granted through the user's roles are
+	// merged into one list.
 	query := `
 	SELECT permissions.code
 	FROM permissions
 	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1`
+	WHERE users_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -59,7 +104,8 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 	INSERT INTO users_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -68,12 +114,115 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	return err
 }
 
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id
+	AND users_permissions.user_id = $1
+	AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// GetAllUsersWithPermission() lists the users holding a code, directly or
+// through a role. Wildcard codes count the same way as in Include(), so a user
+// holding "movies:*" or "*" is listed for "movies:write".
+func (m PermissionModel) GetAllUsersWithPermission(code string) ([]*User, error) {
+	query := `
+	WITH matching AS (
+		SELECT id
+		FROM permissions
+		WHERE code = $1 OR code = '*'
+		OR (right(code, 2) = ':*' AND left($1, length(code) - 1) = left(code, -1))
+	)
+	SELECT users.id, users.created_at, users.name, users.email, users.activated, users.version
+	FROM users
+	WHERE users.id IN (
+		SELECT users_permissions.user_id
+		FROM users_permissions
+		WHERE users_permissions.permission_id IN (SELECT id FROM matching)
+		UNION
+		SELECT users_roles.user_id
+		FROM users_roles
+		INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+		WHERE roles_permissions.permission_id IN (SELECT id FROM matching)
+	)
+	ORDER BY users.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 type MockPermissionModel struct{}
 
+func (m MockPermissionModel) GetAll() (Permissions, error) {
+	return Permissions{"movies:*", "movies:admin", "movies:read", "movies:write", "users:admin"}, nil
+}
+
 func (m MockPermissionModel) GetAllForUser(userID int64) (Permissions, error) {
-	return nil, nil
+	switch userID {
+	case 3:
+		return Permissions{"movies:read", "movies:write"}, nil
+	case 4:
+		return Permissions{"movies:read", "movies:*", "users:admin"}, nil
+	default:
+		return Permissions{"movies:read"}, nil
+	}
 }
 
 func (m MockPermissionModel) AddForUser(userID int64, codes ...string) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (m MockPermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	return nil
+}
+
+func (m MockPermissionModel) GetAllUsersWithPermission(code string) ([]*User, error) {
+	users := []*User{}
+	for _, id := range []int64{1, 3, 4} {
+		permissions, err := m.GetAllForUser(id)
+		if err != nil {
+			return nil, err
+		}
+		if permissions.Include(code) {
+			user := mockUser()
+			user.ID = id
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
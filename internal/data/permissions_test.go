@@ -0,0 +1,29 @@
+package data
+
+import "testing"
+
+func TestPermissionsInclude(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		code        string
+		want        bool
+	}{
+		{"Exact match", Permissions{"movies:read"}, "movies:read", true},
+		{"No match", Permissions{"movies:read"}, "movies:write", false},
+		{"Resource wildcard", Permissions{"movies:*"}, "movies:write", true},
+		{"Resource wildcard covers wildcard", Permissions{"movies:*"}, "movies:*", true},
+		{"Resource wildcard on another resource", Permissions{"movies:*"}, "users:admin", false},
+		{"Wildcard needs a full resource name", Permissions{"movies:*"}, "moviesx:read", false},
+		{"Global wildcard", Permissions{"*"}, "users:admin", true},
+		{"Empty", Permissions{}, "movies:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permissions.Include(tt.code); got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
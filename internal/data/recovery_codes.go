@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// normalizeRecoveryCode() strips the formatting a user might type or paste
+// along with a recovery code, so "abcd-efgh" and "ABCDEFGH" hash the same.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ToUpper(code)
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hash[:]
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+	return codes, nil
+}
+
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// New() replaces any existing recovery codes for the user with a fresh set and
+// returns their plaintext values. Only the hashes are stored.
+func (m RecoveryCodeModel) New(userID int64) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, hashRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Consume() deletes a matching recovery code, reporting whether there was one.
+// Each code can therefore only be used once.
+func (m RecoveryCodeModel) Consume(userID int64, code string) (bool, error) {
+	query := `
+	DELETE FROM recovery_codes
+	WHERE user_id = $1 AND hash = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (m RecoveryCodeModel) DeleteAllForUser(userID int64) error {
+	query := `
+	DELETE FROM recovery_codes
+	WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+type MockRecoveryCodeModel struct{}
+
+func (m MockRecoveryCodeModel) New(userID int64) ([]string, error) {
+	return generateRecoveryCodes()
+}
+
+func (m MockRecoveryCodeModel) Consume(userID int64, code string) (bool, error) {
+	return normalizeRecoveryCode(code) == "AAAABBBBCCCCDDDD", nil
+}
+
+func (m MockRecoveryCodeModel) DeleteAllForUser(userID int64) error {
+	return nil
+}
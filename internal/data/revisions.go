@@ -0,0 +1,183 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieRevision is a snapshot of a movie's details at one version. Revisions
+// are written by MovieModel.Insert and MovieModel.Update.
+type MovieRevision struct {
+	MovieID int64    `json:"movie_id"`
+	Version int32    `json:"version"`
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+	// CreatedBy is the user who made this version, or zero if that isn't
+	// known.
+	CreatedBy int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Apply() copies the revision's details onto the movie, leaving its identity
+// and version alone.
+func (rev *MovieRevision) Apply(movie *Movie) {
+	movie.Title = rev.Title
+	movie.Year = rev.Year
+	movie.Runtime = rev.Runtime
+	movie.Genres = append([]string(nil), rev.Genres...)
+}
+
+// FieldChange describes one field that differs between two revisions.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// DiffRevisions() lists the fields that changed going from one revision to
+// another, in a fixed field order.
+func DiffRevisions(from, to *MovieRevision) []FieldChange {
+	changes := []FieldChange{}
+
+	for _, field := range []struct {
+		name     string
+		from, to any
+	}{
+		{"title", from.Title, to.Title},
+		{"year", from.Year, to.Year},
+		{"runtime", from.Runtime, to.Runtime},
+		{"genres", from.Genres, to.Genres},
+	} {
+		if !reflect.DeepEqual(field.from, field.to) {
+			changes = append(changes, FieldChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+
+	return changes
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie() returns a movie's revisions, newest first. Movies in the
+// trash keep their history but it isn't listed until they're restored.
+func (m MovieRevisionModel) GetAllForMovie(orgID, movieID int64) ([]*MovieRevision, error) {
+	query := `
+	SELECT r.movie_id, r.version, r.title, r.year, r.runtime, r.genres, coalesce(r.created_by, 0), r.created_at
+	FROM movie_revisions r
+	INNER JOIN movies m ON m.id = r.movie_id
+	WHERE r.movie_id = $1 AND m.organization_id = $2 AND m.deleted_at IS NULL
+	ORDER BY r.version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var rev MovieRevision
+
+		err := rows.Scan(
+			&rev.MovieID,
+			&rev.Version,
+			&rev.Title,
+			&rev.Year,
+			&rev.Runtime,
+			pq.Array(&rev.Genres),
+			&rev.CreatedBy,
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, &rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (m MovieRevisionModel) Get(orgID, movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT r.movie_id, r.version, r.title, r.year, r.runtime, r.genres, coalesce(r.created_by, 0), r.created_at
+	FROM movie_revisions r
+	INNER JOIN movies m ON m.id = r.movie_id
+	WHERE r.movie_id = $1 AND r.version = $2 AND m.organization_id = $3 AND m.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rev MovieRevision
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version, orgID).Scan(
+		&rev.MovieID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Year,
+		&rev.Runtime,
+		pq.Array(&rev.Genres),
+		&rev.CreatedBy,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+type MockMovieRevisionModel struct{}
+
+// mockRevisions holds the history of mock movie 1: version 1 was created by
+// user 1 and version 2 changed its title and runtime.
+func mockRevisions() []*MovieRevision {
+	return []*MovieRevision{
+		{MovieID: 1, Version: 2, Title: "Test Mock", Year: 2023, Runtime: 105, Genres: []string{""}, CreatedBy: 1, CreatedAt: time.Now()},
+		{MovieID: 1, Version: 1, Title: "Test Draft", Year: 2023, Runtime: 95, Genres: []string{""}, CreatedBy: 1, CreatedAt: time.Now().Add(-time.Hour)},
+	}
+}
+
+func (m MockMovieRevisionModel) GetAllForMovie(orgID, movieID int64) ([]*MovieRevision, error) {
+	if movieID != 1 {
+		return []*MovieRevision{}, nil
+	}
+	return mockRevisions(), nil
+}
+
+func (m MockMovieRevisionModel) Get(orgID, movieID int64, version int32) (*MovieRevision, error) {
+	if movieID == 1 {
+		for _, rev := range mockRevisions() {
+			if rev.Version == version {
+				return rev, nil
+			}
+		}
+	}
+	return nil, ErrRecordNotFound
+}
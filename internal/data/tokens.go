@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql" // New import
 	"encoding/base32"
+	"errors"
 	"greenlight.bcc/internal/validator" // New import
 	"time"
 )
@@ -13,6 +14,14 @@ import (
 const (
 	ScopeActivation = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset = "password-reset"
+	ScopeRefresh = "refresh"
+	ScopeTwoFactor = "two-factor"
+	ScopeEmailChange = "email-change"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
@@ -21,6 +30,20 @@ type Token struct {
 	UserID int64 `json:"-"`
 	Expiry time.Time `json:"expiry"`
 	Scope string `json:"-"`
+	UserAgent string `json:"-"`
+	IPAddress string `json:"-"`
+	Family []byte `json:"-"`
+}
+
+// Session describes an authentication token issued to a user, without
+// exposing the token itself.
+type Session struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -44,6 +67,37 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+// generateSessionTokens() creates an access and refresh token pair belonging
+// to the same token family. Every token rotated from a single login shares a
+// family, which lets the whole chain be revoked at once.
+func generateSessionTokens(userID int64, accessTTL, refreshTTL time.Duration, family []byte, userAgent, ipAddress string) (*Token, *Token, error) {
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		token.Family = family
+		token.UserAgent = userAgent
+		token.IPAddress = ipAddress
+	}
+
+	return access, refresh, nil
+}
+
+func generateFamily() ([]byte, error) {
+	family := make([]byte, 16)
+	_, err := rand.Read(family)
+	if err != nil {
+		return nil, err
+	}
+	return family, nil
+}
 
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
@@ -64,18 +118,140 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession() issues an access token and a refresh token for a new login,
+// recording the client they were issued to.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error) {
+	family, err := generateFamily()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := generateSessionTokens(userID, accessTTL, refreshTTL, family, userAgent, ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = insertTokens(ctx, m.DB, access, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
+
 // Insert() adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
-	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return insertTokens(ctx, m.DB, token)
+}
+
+// insertTokens() accepts either the connection pool or a transaction.
+func insertTokens(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, tokens ...*Token) error {
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip_address, family)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	for _, token := range tokens {
+		args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IPAddress, token.Family}
+		_, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// Rotate() exchanges an unused refresh token for a new access and refresh token
+// pair in the same family. The presented token is marked as used rather than
+// deleted, so if it is ever presented again the whole family is revoked and
+// ErrTokenReused is returned. The family's previous access token is revoked,
+// and used refresh tokens are purged once they expire, since a reused token
+// that has expired is rejected anyway.
+func (m TokenModel) Rotate(refreshTokenPlaintext string, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(refreshTokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Tokens of a disabled account are deleted when it's disabled, but the
+	// join makes sure one can't be refreshed whatever happened to it.
+	query := `
+	SELECT tokens.user_id, tokens.family, tokens.used_at
+	FROM tokens
+	INNER JOIN users ON users.id = tokens.user_id
+	WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3 AND NOT users.disabled
+	FOR UPDATE OF tokens`
+
+	var (
+		userID int64
+		family []byte
+		usedAt *time.Time
+	)
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(&userID, &family, &usedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if usedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, family)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, tokenHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `
+	DELETE FROM tokens
+	WHERE (family = $1 AND scope = $2)
+	OR (scope = $3 AND used_at IS NOT NULL AND expiry < NOW())`
+
+	_, err = tx.ExecContext(ctx, query, family, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := generateSessionTokens(userID, accessTTL, refreshTTL, family, userAgent, ipAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = insertTokens(ctx, tx, access, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, nil
+}
 
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	query := `
@@ -87,12 +263,119 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+// Delete() removes a single token, identified by its plaintext value, along
+// with any other tokens in its family.
+func (m TokenModel) Delete(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE (scope = $1 AND hash = $2)
+	OR family = (SELECT family FROM tokens WHERE scope = $1 AND hash = $2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
+// Touch() records that a token has just been used. The timestamp is only
+// written once a minute per token to avoid an UPDATE on every request.
+func (m TokenModel) Touch(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW()
+	WHERE scope = $1 AND hash = $2
+	AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	return err
+}
+
+// DeleteOtherSessionsForUser() revokes every access and refresh token for a
+// user except the token matching currentTokenPlaintext and the refresh tokens
+// issued alongside it.
+func (m TokenModel) DeleteOtherSessionsForUser(userID int64, currentTokenPlaintext string) error {
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope IN ($2, $3) AND hash <> $4
+	AND (family IS NULL OR family NOT IN (
+		SELECT family FROM tokens WHERE hash = $4 AND family IS NOT NULL
+	))`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, currentHash[:])
+	return err
+}
+
+// GetAllSessionsForUser() lists the unexpired authentication tokens for a user.
+// The token matching currentTokenPlaintext is flagged as the current session.
+func (m TokenModel) GetAllSessionsForUser(userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+
+	query := `
+	SELECT created_at, expiry, last_used_at, user_agent, ip_address, hash = $3
+	FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND expiry > NOW()
+	ORDER BY created_at DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ScopeAuthentication, userID, currentHash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.CreatedAt,
+			&session.Expiry,
+			&session.LastUsedAt,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
 type MockTokenModel struct {
 	DB *sql.DB
 }
 
 func (m MockTokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
-	return nil,nil
+	return generateToken(userID, ttl, scope)
+}
+
+func (m MockTokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error) {
+	return generateSessionTokens(userID, accessTTL, refreshTTL, nil, userAgent, ipAddress)
+}
+
+func (m MockTokenModel) Rotate(refreshTokenPlaintext string, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*Token, *Token, error) {
+	switch refreshTokenPlaintext {
+	case "cccccccccccccccccccccccccc":
+		return generateSessionTokens(1, accessTTL, refreshTTL, nil, userAgent, ipAddress)
+	case "dddddddddddddddddddddddddd":
+		return nil, nil, ErrTokenReused
+	default:
+		return nil, nil, ErrRecordNotFound
+	}
 }
 
 func (m MockTokenModel) Insert(token *Token) error {
@@ -101,4 +384,28 @@ func (m MockTokenModel) Insert(token *Token) error {
 
 func (m MockTokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return nil
+}
+
+func (m MockTokenModel) Delete(scope, tokenPlaintext string) error {
+	return nil
+}
+
+func (m MockTokenModel) Touch(scope, tokenPlaintext string) error {
+	return nil
+}
+
+func (m MockTokenModel) DeleteOtherSessionsForUser(userID int64, currentTokenPlaintext string) error {
+	return nil
+}
+
+func (m MockTokenModel) GetAllSessionsForUser(userID int64, currentTokenPlaintext string) ([]*Session, error) {
+	return []*Session{
+		{
+			CreatedAt: time.Now(),
+			Expiry:    time.Now().Add(24 * time.Hour),
+			UserAgent: "Go-http-client/1.1",
+			IPAddress: "127.0.0.1",
+			Current:   true,
+		},
+	}, nil
 }
\ No newline at end of file
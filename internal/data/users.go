@@ -5,9 +5,9 @@ import (
 	"crypto/sha256"
 	"database/sql" // New import
 	"errors"
+	"fmt"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"greenlight.bcc/internal/validator"
 )
 
@@ -24,7 +24,22 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	// Disabled is set when an administrator deactivates the account. Unlike
+	// Activated it can't be cleared by the user, so a disabled account can't
+	// be activated again, log in or use its API keys until an administrator
+	// reactivates it.
+	Disabled bool `json:"disabled"`
+	Version  int  `json:"-"`
+	// TOTPSecret is set once enrollment starts, but codes are only required
+	// after the user confirms it and TOTPEnabled is set.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastCounter is the period of the last TOTP code accepted, so that
+	// code and any earlier one can't be used again.
+	TOTPLastCounter int64 `json:"-"`
+	// PendingEmail holds a requested new email address until the change is
+	// confirmed with a token sent to that address.
+	PendingEmail string `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -39,7 +54,16 @@ func ValidateEmail(v *validator.Validator, email string) {
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= maxPasswordLength, "password", fmt.Sprintf("must not be more than %d bytes long", maxPasswordLength))
+}
+
+// ValidatePasswordStrength() rejects passwords that are easy to guess: those on
+// the embedded list of common and breached passwords, and those too similar to
+// the account's email address or name. It's checked whenever a password is
+// chosen, but not at login, so existing users can still sign in.
+func ValidatePasswordStrength(v *validator.Validator, password, email, name string) {
+	v.Check(!commonPasswords.Contains(password), "password", "is too common, please choose a less guessable password")
+	v.Check(!passwordSimilarTo(password, email, name), "password", "is too similar to your email address or name")
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -50,6 +74,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidatePasswordStrength(v, *user.Password.plaintext, user.Email, user.Name)
 	}
 
 	if user.Password.hash == nil {
@@ -58,34 +83,6 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 }
 
-type password struct {
-	plaintext *string
-	hash      []byte
-}
-
-func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
-	if err != nil {
-		return err
-	}
-	p.plaintext = &plaintextPassword
-	p.hash = hash
-	return nil
-}
-
-func (p *password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
-	}
-	return true, nil
-}
-
 type UserModel struct {
 	DB *sql.DB
 }
@@ -112,9 +109,46 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, disabled, version, totp_secret, totp_enabled, totp_last_counter, pending_email
+	FROM users
+	WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Disabled,
+		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastCounter,
+		&user.PendingEmail,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, disabled, version, totp_secret, totp_enabled, totp_last_counter, pending_email
 	FROM users
 	WHERE email = $1`
 	var user User
@@ -127,7 +161,12 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Disabled,
 		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastCounter,
+		&user.PendingEmail,
 	)
 	if err != nil {
 		switch {
@@ -143,14 +182,20 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, totp_secret = $5, totp_enabled = $6, pending_email = $7,
+	totp_last_counter = $8, disabled = $9, version = version + 1
+	WHERE id = $10 AND version = $11
 	RETURNING version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.TOTPSecret,
+		user.TOTPEnabled,
+		user.PendingEmail,
+		user.TOTPLastCounter,
+		user.Disabled,
 		user.ID,
 		user.Version,
 	}
@@ -170,11 +215,96 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// Delete() removes a user. Their tokens, permissions and other dependent rows
+// are removed by the ON DELETE CASCADE foreign keys.
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM users
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll() lists users whose name or email contains the search string, which
+// may be empty to match everyone.
+func (m UserModel) GetAll(search string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, activated, disabled, version
+	FROM users
+	WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{search, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Disabled,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.disabled, users.version,
+	users.totp_secret, users.totp_enabled, users.totp_last_counter, users.pending_email
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -194,7 +324,12 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Disabled,
 		&user.Version,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastCounter,
+		&user.PendingEmail,
 	)
 	if err != nil {
 		switch {
@@ -213,17 +348,114 @@ type MockUserModel struct {
 }
 
 func (m MockUserModel) Insert(user *User) error {
-	return nil
+	switch user.Email {
+	case "baha@gmail.com":
+		return ErrDuplicateEmail
+	default:
+		return nil
+	}
+}
+
+func (m MockUserModel) Get(id int64) (*User, error) {
+	switch id {
+	case 1:
+		return mockUser(), nil
+	case 4:
+		user := mockUser()
+		user.ID = 4
+		return user, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
 }
 
 func (m MockUserModel) GetByEmail(email string) (*User, error) {
-	return nil, nil
+	switch email {
+	case "example@gmail.com":
+		return mockUser(), nil
+	case "inactive@gmail.com":
+		user := mockUser()
+		user.ID = 2
+		user.Email = email
+		user.Activated = false
+		return user, nil
+	case "writer@gmail.com":
+		user := mockUser()
+		user.ID = 3
+		user.Email = email
+		return user, nil
+	case "disabled@gmail.com":
+		user := mockUser()
+		user.ID = 5
+		user.Email = email
+		user.Activated = false
+		user.Disabled = true
+		return user, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
 }
 
 func (m MockUserModel) Update(user *User) error {
 	return nil
 }
 
+func (m MockUserModel) Delete(id int64) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return ErrRecordNotFound
+	}
+}
+
+func (m MockUserModel) GetAll(search string, filters Filters) ([]*User, Metadata, error) {
+	return []*User{mockUser()}, calculateMetadata(1, filters.Page, filters.PageSize), nil
+}
+
 func (m MockUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
-	return nil, nil
+	switch tokenPlaintext {
+	case "bbbbbbbbbbbbbbbbbbbbbbbbbb", "fiorlfkdfiddsfjiovngekwfoe":
+		return mockUser(), nil
+	case "eeeeeeeeeeeeeeeeeeeeeeeeee":
+		user := mockUser()
+		user.TOTPSecret = "JBSWY3DPEHPK3PXP"
+		user.TOTPEnabled = true
+		return user, nil
+	case "kkkkkkkkkkkkkkkkkkkkkkkkkk":
+		user := mockUser()
+		user.Email = "throttled@gmail.com"
+		user.TOTPSecret = "JBSWY3DPEHPK3PXP"
+		user.TOTPEnabled = true
+		return user, nil
+	case "gggggggggggggggggggggggggg":
+		user := mockUser()
+		user.ID = 4
+		return user, nil
+	case "ffffffffffffffffffffffffff":
+		user := mockUser()
+		user.PendingEmail = "new@gmail.com"
+		return user, nil
+	case "llllllllllllllllllllllllll":
+		user := mockUser()
+		user.ID = 5
+		user.Activated = false
+		user.Disabled = true
+		return user, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
+
+func mockUser() *User {
+	return &User{
+		ID:        1,
+		CreatedAt: time.Now(),
+		Name:      "Amanzhol Bakhtiyar",
+		Email:     "example@gmail.com",
+		// The hash is of "pa55word", at bcrypt's minimum cost to keep tests fast.
+		Password:  password{hash: []byte("$2a$04$XfEVqHsm8qolsl.JOgbLVuFxShQLEauKKIrgJBROyx1AaBkV/0dCq")},
+		Activated: true,
+		Version:   1,
+	}
 }
@@ -0,0 +1,339 @@
+// Package jsonpatch applies JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396) documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is wrapped by every error caused by a malformed patch or
+	// one that can't be applied, such as one naming a missing path.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a "test" operation doesn't match.
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+// Operation is one step of a JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidPatch, fmt.Sprintf(format, args...))
+}
+
+// Apply() applies a JSON Patch to the document and returns the result. The
+// add, remove, replace and test operations are supported. Operations are
+// applied in order and the patch is all or nothing: on any error the document
+// is left as it was.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := decode(patch, &ops); err != nil {
+		return nil, invalid("patch must be an array of operations")
+	}
+
+	var target any
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		target, err = apply(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(target any, op Operation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, invalid("%q operation requires a value", op.Op)
+		}
+		if err := decode(op.Value, &value); err != nil {
+			return nil, invalid("value is not valid JSON")
+		}
+	case "remove":
+	default:
+		return nil, invalid("unsupported operation %q", op.Op)
+	}
+
+	if op.Op == "test" {
+		current, err := get(target, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, fmt.Errorf("%w at %q", ErrTestFailed, op.Path)
+		}
+		return target, nil
+	}
+
+	return set(target, tokens, op.Op, value)
+}
+
+// parsePointer() splits a JSON Pointer (RFC 6901) into its unescaped
+// reference tokens. The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, invalid("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func get(target any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := target.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, invalid("path member %q doesn't exist", token)
+			}
+			target = value
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			target = node[i]
+		default:
+			return nil, invalid("path member %q doesn't exist", token)
+		}
+	}
+	return target, nil
+}
+
+// set() performs an add, remove or replace at the location named by tokens,
+// returning the new value of target. Containers are copied rather than
+// modified so a failed operation leaves earlier results untouched.
+func set(target any, tokens []string, op string, value any) (any, error) {
+	if len(tokens) == 0 {
+		switch op {
+		case "remove":
+			return nil, invalid("the whole document can't be removed")
+		default:
+			return value, nil
+		}
+	}
+
+	token, rest := tokens[0], tokens[1:]
+
+	switch node := target.(type) {
+	case map[string]any:
+		child, exists := node[token]
+		if len(rest) > 0 {
+			if !exists {
+				return nil, invalid("path member %q doesn't exist", token)
+			}
+			updated, err := set(child, rest, op, value)
+			if err != nil {
+				return nil, err
+			}
+			return withKey(node, token, updated), nil
+		}
+
+		switch op {
+		case "add":
+			return withKey(node, token, value), nil
+		case "replace":
+			if !exists {
+				return nil, invalid("path member %q doesn't exist", token)
+			}
+			return withKey(node, token, value), nil
+		default:
+			if !exists {
+				return nil, invalid("path member %q doesn't exist", token)
+			}
+			copied := withKey(node, token, nil)
+			delete(copied, token)
+			return copied, nil
+		}
+
+	case []any:
+		if len(rest) > 0 {
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			updated, err := set(node[i], rest, op, value)
+			if err != nil {
+				return nil, err
+			}
+			copied := append([]any(nil), node...)
+			copied[i] = updated
+			return copied, nil
+		}
+
+		switch op {
+		case "add":
+			i := len(node)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			copied := make([]any, 0, len(node)+1)
+			copied = append(copied, node[:i]...)
+			copied = append(copied, value)
+			return append(copied, node[i:]...), nil
+		case "replace":
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			copied := append([]any(nil), node...)
+			copied[i] = value
+			return copied, nil
+		default:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			copied := make([]any, 0, len(node)-1)
+			copied = append(copied, node[:i]...)
+			return append(copied, node[i+1:]...), nil
+		}
+	}
+
+	return nil, invalid("path member %q doesn't exist", token)
+}
+
+func withKey(node map[string]any, key string, value any) map[string]any {
+	copied := make(map[string]any, len(node)+1)
+	for k, v := range node {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// arrayIndex() parses an array index token, which must be between 0 and max.
+func arrayIndex(token string, max int) (int, error) {
+	// Leading zeros and signs aren't allowed by RFC 6901.
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.ContainsAny(token, "+-") {
+		return 0, invalid("%q is not a valid array index", token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, invalid("array index %q is out of range", token)
+	}
+	return i, nil
+}
+
+// equal() compares two decoded JSON values, treating numbers as equal when
+// they have the same numeric value.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aErr := a.Float64()
+		bf, bErr := b.Float64()
+		return aErr == nil && bErr == nil && af == bf
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if other, ok := b[k]; !ok || !equal(v, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// MergePatch() applies a JSON Merge Patch to the document and returns the
+// result. Members set to null in the patch are removed; objects are merged
+// recursively and any other value replaces what was there.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := decode(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := decode(patch, &p); err != nil {
+		return nil, invalid("patch is not valid JSON")
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	result := make(map[string]any, len(t))
+	for k, v := range t {
+		result[k] = v
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = merge(result[k], v)
+	}
+
+	return result
+}
+
+// decode() unmarshals JSON keeping numbers as json.Number, so they're
+// written back out exactly as they came in.
+func decode(js []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
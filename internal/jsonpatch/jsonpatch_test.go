@@ -0,0 +1,90 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+
+	"greenlight.bcc/internal/assert"
+)
+
+const doc = `{"title":"Casablanca","year":1942,"genres":["drama","romance"]}`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{"Add member", `[{"op":"add","path":"/runtime","value":"102 mins"}]`, `{"genres":["drama","romance"],"runtime":"102 mins","title":"Casablanca","year":1942}`, nil},
+		{"Append to array", `[{"op":"add","path":"/genres/-","value":"war"}]`, `{"genres":["drama","romance","war"],"title":"Casablanca","year":1942}`, nil},
+		{"Insert into array", `[{"op":"add","path":"/genres/0","value":"war"}]`, `{"genres":["war","drama","romance"],"title":"Casablanca","year":1942}`, nil},
+		{"Remove member", `[{"op":"remove","path":"/year"}]`, `{"genres":["drama","romance"],"title":"Casablanca"}`, nil},
+		{"Remove from array", `[{"op":"remove","path":"/genres/0"}]`, `{"genres":["romance"],"title":"Casablanca","year":1942}`, nil},
+		{"Replace member", `[{"op":"replace","path":"/year","value":1943}]`, `{"genres":["drama","romance"],"title":"Casablanca","year":1943}`, nil},
+		{"Passing test", `[{"op":"test","path":"/year","value":1942.0},{"op":"replace","path":"/title","value":"X"}]`, `{"genres":["drama","romance"],"title":"X","year":1942}`, nil},
+		{"Failing test", `[{"op":"replace","path":"/title","value":"X"},{"op":"test","path":"/year","value":1943}]`, "", ErrTestFailed},
+		{"Replace missing member", `[{"op":"replace","path":"/runtime","value":"102 mins"}]`, "", ErrInvalidPatch},
+		{"Remove missing member", `[{"op":"remove","path":"/runtime"}]`, "", ErrInvalidPatch},
+		{"Index out of range", `[{"op":"replace","path":"/genres/2","value":"war"}]`, "", ErrInvalidPatch},
+		{"Leading zero index", `[{"op":"remove","path":"/genres/01"}]`, "", ErrInvalidPatch},
+		{"Path without slash", `[{"op":"remove","path":"year"}]`, "", ErrInvalidPatch},
+		{"Missing value", `[{"op":"add","path":"/runtime"}]`, "", ErrInvalidPatch},
+		{"Unsupported operation", `[{"op":"move","from":"/year","path":"/released"}]`, "", ErrInvalidPatch},
+		{"Not an array", `{"op":"remove","path":"/year"}`, "", ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantErr), true)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(got), tt.want)
+		})
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tokens, err := parsePointer("/a~1b/c~0d/~01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(tokens), 3)
+	assert.Equal(t, tokens[0], "a/b")
+	assert.Equal(t, tokens[1], "c~d")
+	assert.Equal(t, tokens[2], "~1")
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"Replace member", doc, `{"year":1943}`, `{"genres":["drama","romance"],"title":"Casablanca","year":1943}`},
+		{"Remove member", doc, `{"year":null}`, `{"genres":["drama","romance"],"title":"Casablanca"}`},
+		{"Arrays are replaced", doc, `{"genres":["war"]}`, `{"genres":["war"],"title":"Casablanca","year":1942}`},
+		{"Nested objects merge", `{"a":{"b":1,"c":2}}`, `{"a":{"c":null,"d":3}}`, `{"a":{"b":1,"d":3}}`},
+		{"Non-object patch replaces", doc, `["war"]`, `["war"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(got), tt.want)
+		})
+	}
+
+	_, err := MergePatch([]byte(doc), []byte(`{`))
+	assert.Equal(t, errors.Is(err, ErrInvalidPatch), true)
+}
@@ -0,0 +1,86 @@
+package signedtoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+var (
+	oldKey = []byte("0123456789abcdef0123456789abcdef")
+	newKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestVerify(t *testing.T) {
+	oldSigner, err := New(map[string][]byte{"k1": oldKey}, "k1")
+	assert.NilError(t, err)
+
+	signer, err := New(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	assert.NilError(t, err)
+
+	claims := Claims{UserID: 7, Scope: "authentication", Activated: true, Expiry: time.Now().Add(time.Hour).Unix()}
+
+	valid, err := signer.Sign(claims)
+	assert.NilError(t, err)
+
+	rotated, err := oldSigner.Sign(claims)
+	assert.NilError(t, err)
+
+	expiredClaims := claims
+	expiredClaims.Expiry = time.Now().Add(-time.Minute).Unix()
+	expired, err := signer.Sign(expiredClaims)
+	assert.NilError(t, err)
+
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   string
+		wantErr error
+	}{
+		{"Valid token", valid, "authentication", nil},
+		{"Signed with previous key", rotated, "authentication", nil},
+		{"Wrong scope", valid, "activation", ErrInvalidToken},
+		{"Expired token", expired, "authentication", ErrExpiredToken},
+		{"Tampered payload", tampered, "authentication", ErrInvalidToken},
+		{"Malformed token", "abc", "authentication", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signer.Verify(tt.token, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got: %v; want: %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil {
+				assert.Equal(t, got.UserID, claims.UserID)
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	signer, err := New(map[string][]byte{"k1": oldKey}, "k1")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	token, err := signer.Sign(Claims{UserID: 7, Scope: "authentication", Expiry: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := signer.Verify(token, "authentication")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"greenlight.bcc/internal/assert"
+)
+
+// The test vectors are the SHA1 cases from RFC 6238 appendix B, truncated to
+// six digits.
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name string
+		time int64
+		code string
+		want bool
+	}{
+		{"RFC vector 59", 59, "287082", true},
+		{"RFC vector 1111111109", 1111111109, "081804", true},
+		{"RFC vector 1234567890", 1234567890, "005924", true},
+		{"RFC vector 2000000000", 2000000000, "279037", true},
+		{"Previous period", 59 + 30, "287082", true},
+		{"Too old", 59 + 90, "287082", false},
+		{"Wrong code", 59, "123456", false},
+		{"Wrong length", 59, "28708", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(secret, tt.code, time.Unix(tt.time, 0), 0)
+			assert.Equal(t, ok, tt.want)
+		})
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	// 287082 is the code for counter 1 (the period containing t = 59).
+	counter, ok := Validate(secret, "287082", time.Unix(59, 0), 0)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, counter, int64(1))
+
+	tests := []struct {
+		name        string
+		time        int64
+		lastCounter int64
+		want        bool
+	}{
+		{"Same code again", 59, 1, false},
+		{"Same code in the next period", 59 + 30, 1, false},
+		{"Later code already used", 59, 2, false},
+		{"Earlier code used", 59, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(secret, "287082", time.Unix(tt.time, 0), tt.lastCounter)
+			assert.Equal(t, ok, tt.want)
+		})
+	}
+}
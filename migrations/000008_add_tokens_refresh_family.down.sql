@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tokens_family_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family;
+ALTER TABLE tokens DROP COLUMN IF EXISTS used_at;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS login_failure_counts;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_failure_counts (
+key text PRIMARY KEY,
+count integer NOT NULL,
+last_failed_at timestamp(0) with time zone NOT NULL,
+previous_failed_at timestamp(0) with time zone NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+DELETE FROM permissions WHERE code = 'users:admin';
\ No newline at end of file
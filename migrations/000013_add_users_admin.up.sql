@@ -0,0 +1,4 @@
+INSERT INTO permissions (code)
+VALUES ('users:admin');
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled bool NOT NULL DEFAULT false;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'movies:admin';
+
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
\ No newline at end of file
@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS organizations (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+name text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+role_id bigint NOT NULL REFERENCES roles,
+PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+id bigserial PRIMARY KEY,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+email citext NOT NULL,
+hash bytea UNIQUE NOT NULL,
+role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_email_idx ON organization_invitations (email);
+
+-- Existing movies and users are moved into a default organization so the
+-- catalog keeps working for them. Users who hold users:admin become its
+-- admins and users who can write movies become its editors, directly or
+-- through a role; everyone else joins as a viewer.
+INSERT INTO organizations (name)
+VALUES ('Default');
+
+WITH held AS (
+SELECT users_permissions.user_id, permissions.code
+FROM users_permissions
+INNER JOIN permissions ON users_permissions.permission_id = permissions.id
+UNION
+SELECT users_roles.user_id, permissions.code
+FROM users_roles
+INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+INNER JOIN permissions ON roles_permissions.permission_id = permissions.id
+)
+INSERT INTO organization_members
+SELECT organizations.id, users.id, roles.id
+FROM organizations, users, roles
+WHERE organizations.name = 'Default' AND roles.name = CASE
+WHEN EXISTS (SELECT 1 FROM held WHERE held.user_id = users.id AND held.code IN ('users:admin', '*')) THEN 'admin'
+WHEN EXISTS (SELECT 1 FROM held WHERE held.user_id = users.id AND held.code IN ('movies:write', 'movies:*')) THEN 'editor'
+ELSE 'viewer'
+END;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS organization_id bigint REFERENCES organizations ON DELETE CASCADE;
+UPDATE movies SET organization_id = (SELECT id FROM organizations WHERE name = 'Default');
+ALTER TABLE movies ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+version integer NOT NULL,
+title text NOT NULL,
+year integer NOT NULL,
+runtime integer NOT NULL,
+genres text[] NOT NULL,
+created_by bigint REFERENCES users ON DELETE SET NULL,
+created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+PRIMARY KEY (movie_id, version)
+);
+
+-- Earlier versions weren't kept, so history starts from each movie's current
+-- version. Who made that version isn't known either.
+INSERT INTO movie_revisions (movie_id, version, title, year, runtime, genres, created_at)
+SELECT id, version, title, year, runtime, genres, created_at
+FROM movies;
\ No newline at end of file